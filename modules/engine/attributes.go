@@ -99,6 +99,8 @@ var (
 	MetaWorkstation             = NewAttribute("_workstation")
 	MetaServer                  = NewAttribute("_server")
 	MetaLAPSInstalled           = NewAttribute("_haslaps")
+	MetaWindowsLAPSInstalled    = NewAttribute("_haswindowslaps")
+	MetaNoLAPS                  = NewAttribute("_nolaps")
 )
 
 type Attribute int16
@@ -41,6 +41,7 @@ var (
 	ObjectTypeExecutable                 = NewObjectType("Executable", "Executable").SetDefault(Last, false)
 	ObjectTypeDirectory                  = NewObjectType("Directory", "Directory").SetDefault(Last, false)
 	ObjectTypeFile                       = NewObjectType("File", "File").SetDefault(Last, false)
+	ObjectTypeScheduledTask              = NewObjectType("ScheduledTask", "ScheduledTask").SetDefault(Last, false)
 )
 
 var objecttypenames = make(map[string]ObjectType)
@@ -0,0 +1,162 @@
+package ese
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	COMPRESS_7BITASCII   = 0x1
+	COMPRESS_7BITUNICODE = 0x2
+	COMPRESS_XPRESS      = 0x3
+	COMPRESS_SCRUB       = 0x4
+	COMPRESS_XPRESS9     = 0x5
+	COMPRESS_XPRESS10    = 0x6
+)
+
+var ErrUnsupportedCompression = errors.New("unsupported ESE compression scheme")
+
+// Decompress handles column data compressed by ESE, the compression scheme is in the top 5 bits of the first byte
+func Decompress(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return data, nil
+	}
+	switch data[0] >> 3 {
+	case COMPRESS_7BITASCII:
+		return decompress7bit(data, false), nil
+	case COMPRESS_7BITUNICODE:
+		return decompress7bit(data, true), nil
+	case COMPRESS_XPRESS:
+		if len(data) < 3 {
+			return nil, fmt.Errorf("xpress compressed data too short: %w", ErrCorrupt)
+		}
+		return decompressXpress(data[3:], int(binary.LittleEndian.Uint16(data[1:])))
+	case COMPRESS_XPRESS9:
+		return nil, fmt.Errorf("XPRESS9 compressed column: %w", ErrUnsupportedCompression)
+	case COMPRESS_XPRESS10:
+		return nil, fmt.Errorf("XPRESS10 compressed column: %w", ErrUnsupportedCompression)
+	default:
+		return nil, fmt.Errorf("compression scheme %v: %w", data[0]>>3, ErrUnsupportedCompression)
+	}
+}
+
+func decompress7bit(data []byte, unicode bool) []byte {
+	if len(data) < 2 {
+		return nil
+	}
+	finalbits := int(data[0]&0x7) + 1
+	totalbits := (len(data)-2)*8 + finalbits
+	count := totalbits / 7
+
+	result := make([]byte, 0, count*2)
+	var buffer uint32
+	var bits int
+	input := data[1:]
+	for i := 0; i < count; i++ {
+		for bits < 7 {
+			buffer |= uint32(input[0]) << bits
+			input = input[1:]
+			bits += 8
+		}
+		c := byte(buffer & 0x7f)
+		buffer >>= 7
+		bits -= 7
+		result = append(result, c)
+		if unicode {
+			result = append(result, 0)
+		}
+	}
+	return result
+}
+
+// decompressXpress implements the plain LZ77 variant from MS-XCA
+func decompressXpress(input []byte, size int) ([]byte, error) {
+	output := make([]byte, 0, size)
+
+	var flags uint32
+	var flagcount int
+	var lasthalfbyte int
+	pos := 0
+
+	for pos < len(input) {
+		if flagcount == 0 {
+			if pos+4 > len(input) {
+				break
+			}
+			flags = binary.LittleEndian.Uint32(input[pos:])
+			pos += 4
+			flagcount = 32
+		}
+		flagcount--
+		if flags&(1<<flagcount) == 0 {
+			if pos >= len(input) {
+				break
+			}
+			output = append(output, input[pos])
+			pos++
+			continue
+		}
+
+		if pos+2 > len(input) {
+			break
+		}
+		matchbytes := int(binary.LittleEndian.Uint16(input[pos:]))
+		pos += 2
+		length := matchbytes % 8
+		offset := matchbytes/8 + 1
+		if length == 7 {
+			if lasthalfbyte == 0 {
+				if pos >= len(input) {
+					return nil, ErrCorrupt
+				}
+				length = int(input[pos] % 16)
+				lasthalfbyte = pos
+				pos++
+			} else {
+				length = int(input[lasthalfbyte] / 16)
+				lasthalfbyte = 0
+			}
+			if length == 15 {
+				if pos >= len(input) {
+					return nil, ErrCorrupt
+				}
+				length = int(input[pos])
+				pos++
+				if length == 255 {
+					if pos+2 > len(input) {
+						return nil, ErrCorrupt
+					}
+					length = int(binary.LittleEndian.Uint16(input[pos:]))
+					pos += 2
+					if length == 0 {
+						if pos+4 > len(input) {
+							return nil, ErrCorrupt
+						}
+						length = int(binary.LittleEndian.Uint32(input[pos:]))
+						pos += 4
+					}
+					if length < 15+7 {
+						return nil, ErrCorrupt
+					}
+					length -= 15 + 7
+				}
+				length += 15
+			}
+			length += 7
+		}
+		length += 3
+
+		if offset > len(output) {
+			return nil, fmt.Errorf("xpress match offset %v before start of output: %w", offset, ErrCorrupt)
+		}
+		for i := 0; i < length; i++ {
+			output = append(output, output[len(output)-offset])
+		}
+	}
+
+	if len(output) > size && size > 0 {
+		output = output[:size]
+	}
+	return output, nil
+}
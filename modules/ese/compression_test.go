@@ -0,0 +1,85 @@
+package ese
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestDecompress(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       []byte
+		expected    []byte
+		unsupported bool
+	}{
+		{
+			name:     "empty",
+			input:    []byte{},
+			expected: []byte{},
+		},
+		{
+			name:     "7-bit ASCII",
+			input:    []byte{0x0c, 0x61, 0xf1, 0x18},
+			expected: []byte("abc"),
+		},
+		{
+			name:     "7-bit Unicode",
+			input:    []byte{0x12, 0x41, 0x72, 0x3b, 0xed, 0x06},
+			expected: []byte("A\x00d\x00m\x00i\x00n\x00"),
+		},
+		{
+			name:     "XPRESS literals only",
+			input:    []byte{0x18, 0x03, 0x00, 0x00, 0x00, 0x00, 0x00, 'a', 'b', 'c'},
+			expected: []byte("abc"),
+		},
+		{
+			name: "XPRESS with match",
+			// Three literals, then a match with offset 3 and length 6
+			input:    []byte{0x18, 0x09, 0x00, 0x00, 0x00, 0x00, 0x10, 'a', 'b', 'c', 0x13, 0x00},
+			expected: []byte("abcabcabc"),
+		},
+		{
+			name: "XPRESS with extended length",
+			// One literal, then a match with offset 1 and length 3+7+4 from the half byte
+			input:    []byte{0x18, 0x0f, 0x00, 0x00, 0x00, 0x00, 0x40, 'x', 0x07, 0x00, 0x04},
+			expected: bytes.Repeat([]byte("x"), 15),
+		},
+		{
+			name:        "XPRESS9",
+			input:       []byte{0x28, 0x00, 0x00},
+			unsupported: true,
+		},
+		{
+			name:        "XPRESS10",
+			input:       []byte{0x30, 0x00, 0x00},
+			unsupported: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := Decompress(test.input)
+			if test.unsupported {
+				if !errors.Is(err, ErrUnsupportedCompression) {
+					t.Fatalf("expected unsupported compression error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !bytes.Equal(result, test.expected) {
+				t.Errorf("expected %q, got %q", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestDecompressXpressBadOffset(t *testing.T) {
+	// Match before any literals
+	_, err := Decompress([]byte{0x18, 0x03, 0x00, 0x00, 0x00, 0x00, 0x80, 0x00, 0x00})
+	if !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("expected corrupt error, got %v", err)
+	}
+}
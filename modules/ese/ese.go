@@ -0,0 +1,785 @@
+package ese
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"unicode/utf16"
+)
+
+// Minimal read-only parser for Extensible Storage Engine (JET Blue) databases, as used by NTDS.dit
+// https://github.com/libyal/libesedb/blob/main/documentation/Extensible%20Storage%20Engine%20(ESE)%20Database%20File%20(EDB)%20format.asciidoc
+
+const (
+	headerSignature = 0x89abcdef
+
+	catalogPage = 4
+
+	// Page flags
+	PAGE_ROOT       = 0x0001
+	PAGE_LEAF       = 0x0002
+	PAGE_PARENT     = 0x0004
+	PAGE_EMPTY      = 0x0008
+	PAGE_SPACE_TREE = 0x0020
+	PAGE_INDEX      = 0x0040
+	PAGE_LONG_VALUE = 0x0080
+
+	// Page tag flags
+	TAG_UNKNOWN = 0x1
+	TAG_DEFUNCT = 0x2
+	TAG_COMMON  = 0x4
+
+	// Tagged data flags
+	TAGGED_LONG_VALUE  = 0x01
+	TAGGED_COMPRESSED  = 0x02
+	TAGGED_SEPARATED   = 0x04
+	TAGGED_MULTI_VALUE = 0x08
+	TAGGED_TWO_VALUES  = 0x10
+	TAGGED_NULL        = 0x20
+
+	// Catalog types
+	CATALOG_TABLE      = 1
+	CATALOG_COLUMN     = 2
+	CATALOG_INDEX      = 3
+	CATALOG_LONG_VALUE = 4
+
+	// Database states
+	STATE_JUST_CREATED   = 1
+	STATE_DIRTY_SHUTDOWN = 2
+	STATE_CLEAN_SHUTDOWN = 3
+)
+
+type ColumnType uint32
+
+const (
+	JET_coltypNil ColumnType = iota
+	JET_coltypBit
+	JET_coltypUnsignedByte
+	JET_coltypShort
+	JET_coltypLong
+	JET_coltypCurrency
+	JET_coltypIEEESingle
+	JET_coltypIEEEDouble
+	JET_coltypDateTime
+	JET_coltypBinary
+	JET_coltypText
+	JET_coltypLongBinary
+	JET_coltypLongText
+	JET_coltypSLV
+	JET_coltypUnsignedLong
+	JET_coltypLongLong
+	JET_coltypGUID
+	JET_coltypUnsignedShort
+)
+
+var fixedColumnSizes = map[ColumnType]int{
+	JET_coltypBit:           1,
+	JET_coltypUnsignedByte:  1,
+	JET_coltypShort:         2,
+	JET_coltypLong:          4,
+	JET_coltypCurrency:      8,
+	JET_coltypIEEESingle:    4,
+	JET_coltypIEEEDouble:    8,
+	JET_coltypDateTime:      8,
+	JET_coltypUnsignedLong:  4,
+	JET_coltypLongLong:      8,
+	JET_coltypGUID:          16,
+	JET_coltypUnsignedShort: 2,
+}
+
+var ErrCorrupt = errors.New("corrupt ESE database")
+
+type Database struct {
+	f        *os.File
+	pagesize int
+	version  uint32
+	revision uint32
+	state    uint32
+
+	largepages bool
+
+	tables map[string]*Table
+}
+
+type Table struct {
+	db *Database
+
+	Name     string
+	ObjID    uint32
+	RootPage uint32
+	LVPage   uint32
+	Columns  []*Column
+
+	lvindex map[string][]lvsegment
+}
+
+type Column struct {
+	ID       uint32
+	Name     string
+	Type     ColumnType
+	Size     uint32
+	Codepage uint32
+}
+
+type lvsegment struct {
+	offset uint32
+	page   uint32
+	tag    int
+}
+
+// Record holds all non-null values for a row, indexed by column ID
+type Record map[uint32][][]byte
+
+type page struct {
+	number uint32
+	data   []byte
+	flags  uint32
+	next   uint32
+	tags   int
+
+	headersize int
+}
+
+func Open(path string) (*Database, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	db := &Database{
+		f:      f,
+		tables: make(map[string]*Table),
+	}
+
+	header := make([]byte, 668)
+	_, err = io.ReadFull(f, header)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("problem reading ESE database header: %v", err)
+	}
+
+	if binary.LittleEndian.Uint32(header[4:]) != headerSignature {
+		f.Close()
+		return nil, fmt.Errorf("invalid ESE database signature %08x", binary.LittleEndian.Uint32(header[4:]))
+	}
+
+	db.version = binary.LittleEndian.Uint32(header[8:])
+	db.state = binary.LittleEndian.Uint32(header[52:])
+	db.revision = binary.LittleEndian.Uint32(header[232:])
+	db.pagesize = int(binary.LittleEndian.Uint32(header[236:]))
+	if db.pagesize == 0 {
+		db.pagesize = 4096
+	}
+	switch db.pagesize {
+	case 2048, 4096, 8192, 16384, 32768:
+	default:
+		f.Close()
+		return nil, fmt.Errorf("unsupported ESE page size %v", db.pagesize)
+	}
+	db.largepages = db.revision >= 0x11 && db.pagesize > 8192
+
+	err = db.parseCatalog()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("problem parsing ESE catalog: %v", err)
+	}
+
+	return db, nil
+}
+
+func (db *Database) Close() error {
+	return db.f.Close()
+}
+
+// State returns the database state from the header, databases not in STATE_CLEAN_SHUTDOWN might be inconsistent
+func (db *Database) State() uint32 {
+	return db.state
+}
+
+func (db *Database) PageSize() int {
+	return db.pagesize
+}
+
+func (db *Database) Table(name string) (*Table, bool) {
+	t, found := db.tables[name]
+	return t, found
+}
+
+func (db *Database) Tables() []string {
+	var result []string
+	for name := range db.tables {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func (db *Database) readPage(number uint32) (*page, error) {
+	data := make([]byte, db.pagesize)
+	_, err := db.f.ReadAt(data, (int64(number)+1)*int64(db.pagesize))
+	if err != nil {
+		return nil, fmt.Errorf("problem reading page %v: %v", number, err)
+	}
+
+	p := page{
+		number:     number,
+		data:       data,
+		headersize: 40,
+	}
+	p.next = binary.LittleEndian.Uint32(data[20:])
+	p.tags = int(binary.LittleEndian.Uint16(data[34:]))
+	p.flags = binary.LittleEndian.Uint32(data[36:])
+	if db.largepages {
+		p.headersize = 80
+	}
+	if p.tags*4 > db.pagesize-p.headersize {
+		return nil, fmt.Errorf("page %v claims %v tags: %w", number, p.tags, ErrCorrupt)
+	}
+	return &p, nil
+}
+
+// tag returns the flags and data for a tag on the page
+func (db *Database) tag(p *page, index int) (byte, []byte, error) {
+	if index >= p.tags {
+		return 0, nil, fmt.Errorf("tag %v out of range on page %v: %w", index, p.number, ErrCorrupt)
+	}
+	tagoffset := db.pagesize - 4*(index+1)
+	rawsize := binary.LittleEndian.Uint16(p.data[tagoffset:])
+	rawoffset := binary.LittleEndian.Uint16(p.data[tagoffset+2:])
+
+	var size, offset int
+	var flags byte
+	if db.largepages {
+		size = int(rawsize & 0x7fff)
+		offset = int(rawoffset & 0x7fff)
+	} else {
+		size = int(rawsize & 0x1fff)
+		offset = int(rawoffset & 0x1fff)
+		flags = byte(rawoffset >> 13)
+	}
+
+	start := p.headersize + offset
+	if start+size > len(p.data) {
+		return 0, nil, fmt.Errorf("tag %v on page %v exceeds page: %w", index, p.number, ErrCorrupt)
+	}
+	data := p.data[start : start+size]
+
+	if db.largepages && size >= 2 && index > 0 {
+		// Flags are stored in the top bits of the first key size field
+		data = append([]byte{}, data...)
+		flags = data[1] >> 5
+		data[1] &= 0x1f
+	}
+
+	return flags, data, nil
+}
+
+// entry splits a leaf or branch entry into the full key and remaining data
+func (db *Database) entry(p *page, index int) (byte, []byte, []byte, error) {
+	flags, data, err := db.tag(p, index)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+
+	var commonsize int
+	if flags&TAG_COMMON != 0 {
+		if len(data) < 2 {
+			return 0, nil, nil, ErrCorrupt
+		}
+		commonsize = int(binary.LittleEndian.Uint16(data))
+		data = data[2:]
+	}
+	if len(data) < 2 {
+		return 0, nil, nil, ErrCorrupt
+	}
+	localsize := int(binary.LittleEndian.Uint16(data))
+	data = data[2:]
+	if localsize > len(data) {
+		return 0, nil, nil, fmt.Errorf("key size %v exceeds entry on page %v: %w", localsize, p.number, ErrCorrupt)
+	}
+
+	key := data[:localsize]
+	if commonsize > 0 {
+		_, prefix, err := db.tag(p, 0)
+		if err != nil {
+			return 0, nil, nil, err
+		}
+		if commonsize > len(prefix) {
+			return 0, nil, nil, fmt.Errorf("common key size %v exceeds prefix on page %v: %w", commonsize, p.number, ErrCorrupt)
+		}
+		key = append(append([]byte{}, prefix[:commonsize]...), key...)
+	}
+	return flags, key, data[localsize:], nil
+}
+
+// walk calls the callback for every leaf entry in the tree rooted at the given page
+func (db *Database) walk(root uint32, cb func(p *page, index int, key, data []byte) error) error {
+	return db.walkpage(root, 0, cb)
+}
+
+func (db *Database) walkpage(number uint32, depth int, cb func(p *page, index int, key, data []byte) error) error {
+	if depth > 16 {
+		return fmt.Errorf("tree too deep at page %v: %w", number, ErrCorrupt)
+	}
+
+	p, err := db.readPage(number)
+	if err != nil {
+		return err
+	}
+
+	if p.flags&(PAGE_EMPTY|PAGE_SPACE_TREE|PAGE_INDEX) != 0 {
+		return nil
+	}
+
+	for i := 1; i < p.tags; i++ {
+		flags, key, data, err := db.entry(p, i)
+		if err != nil {
+			return err
+		}
+		if flags&TAG_DEFUNCT != 0 {
+			continue
+		}
+		if p.flags&PAGE_LEAF != 0 {
+			err = cb(p, i, key, data)
+		} else {
+			if len(data) < 4 {
+				return fmt.Errorf("branch entry %v on page %v has no child: %w", i, number, ErrCorrupt)
+			}
+			err = db.walkpage(binary.LittleEndian.Uint32(data[len(data)-4:]), depth+1, cb)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *Database) parseCatalog() error {
+	tablesbyid := make(map[uint32]*Table)
+
+	return db.walk(catalogPage, func(p *page, index int, key, data []byte) error {
+		if len(data) < 30 {
+			return fmt.Errorf("catalog entry too short: %w", ErrCorrupt)
+		}
+		objid := binary.LittleEndian.Uint32(data[4:])
+		ctype := binary.LittleEndian.Uint16(data[8:])
+		id := binary.LittleEndian.Uint32(data[10:])
+		coltypeorfdp := binary.LittleEndian.Uint32(data[14:])
+		spaceusage := binary.LittleEndian.Uint32(data[18:])
+		pagesorlocale := binary.LittleEndian.Uint32(data[26:])
+
+		values, err := db.parseVariable(data)
+		if err != nil {
+			return err
+		}
+		var name string
+		if v, found := values[128]; found {
+			name = string(v)
+		}
+
+		switch ctype {
+		case CATALOG_TABLE:
+			t := &Table{
+				db:       db,
+				Name:     name,
+				ObjID:    id,
+				RootPage: coltypeorfdp,
+			}
+			tablesbyid[id] = t
+			db.tables[name] = t
+		case CATALOG_COLUMN:
+			t := tablesbyid[objid]
+			if t == nil {
+				return fmt.Errorf("column %v for unknown table %v: %w", name, objid, ErrCorrupt)
+			}
+			t.Columns = append(t.Columns, &Column{
+				ID:       id,
+				Name:     name,
+				Type:     ColumnType(coltypeorfdp),
+				Size:     spaceusage,
+				Codepage: pagesorlocale,
+			})
+		case CATALOG_LONG_VALUE:
+			if t := tablesbyid[objid]; t != nil {
+				t.LVPage = coltypeorfdp
+			}
+		}
+		return nil
+	})
+}
+
+// parseVariable returns only the variable size columns of a record, used for bootstrapping the catalog
+func (db *Database) parseVariable(data []byte) (map[uint32][]byte, error) {
+	result := make(map[uint32][]byte)
+	lastvariable := int(data[1])
+	varoffset := int(binary.LittleEndian.Uint16(data[2:]))
+	if lastvariable <= 127 {
+		return result, nil
+	}
+	count := lastvariable - 127
+	vardata := varoffset + 2*count
+	if vardata > len(data) {
+		return nil, fmt.Errorf("variable data offset exceeds record: %w", ErrCorrupt)
+	}
+	var prev int
+	for i := 0; i < count; i++ {
+		end := binary.LittleEndian.Uint16(data[varoffset+2*i:])
+		if end&0x8000 != 0 {
+			continue
+		}
+		if vardata+int(end) > len(data) || int(end) < prev {
+			return nil, fmt.Errorf("variable column exceeds record: %w", ErrCorrupt)
+		}
+		result[uint32(128+i)] = data[vardata+prev : vardata+int(end)]
+		prev = int(end)
+	}
+	return result, nil
+}
+
+// ColumnByName finds a column in the table, returns nil if not found
+func (t *Table) ColumnByName(name string) *Column {
+	for _, c := range t.Columns {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// Walk calls the callback with every record in the table, in primary key order
+func (t *Table) Walk(cb func(r Record) error) error {
+	sort.Slice(t.Columns, func(i, j int) bool {
+		return t.Columns[i].ID < t.Columns[j].ID
+	})
+	return t.db.walk(t.RootPage, func(p *page, index int, key, data []byte) error {
+		r, err := t.parseRecord(data)
+		if err != nil {
+			return fmt.Errorf("problem parsing record on page %v tag %v: %w", p.number, index, err)
+		}
+		return cb(r)
+	})
+}
+
+func (t *Table) parseRecord(data []byte) (Record, error) {
+	if len(data) < 4 {
+		return nil, ErrCorrupt
+	}
+	r := make(Record)
+
+	lastfixed := uint32(data[0])
+	lastvariable := uint32(data[1])
+	varoffset := int(binary.LittleEndian.Uint16(data[2:]))
+
+	// Fixed size columns
+	fixedoffset := 4
+	nullbitmap := varoffset - (int(lastfixed)+7)/8
+	for _, c := range t.Columns {
+		if c.ID > lastfixed {
+			break
+		}
+		size, found := fixedColumnSizes[c.Type]
+		if !found {
+			size = int(c.Size)
+		}
+		if fixedoffset+size > len(data) {
+			return nil, fmt.Errorf("fixed column %v exceeds record: %w", c.Name, ErrCorrupt)
+		}
+		bit := int(c.ID - 1)
+		if nullbitmap < 0 || nullbitmap+bit/8 >= len(data) || data[nullbitmap+bit/8]&(1<<(bit%8)) == 0 {
+			r[c.ID] = [][]byte{data[fixedoffset : fixedoffset+size]}
+		}
+		fixedoffset += size
+	}
+
+	// Variable size columns
+	var varend int
+	var varcount int
+	if lastvariable > 127 {
+		varcount = int(lastvariable - 127)
+		vardata := varoffset + 2*varcount
+		if vardata > len(data) {
+			return nil, fmt.Errorf("variable data offset exceeds record: %w", ErrCorrupt)
+		}
+		for i := 0; i < varcount; i++ {
+			end := binary.LittleEndian.Uint16(data[varoffset+2*i:])
+			if end&0x8000 != 0 {
+				continue
+			}
+			if vardata+int(end&0x7fff) > len(data) || int(end&0x7fff) < varend {
+				return nil, fmt.Errorf("variable column exceeds record: %w", ErrCorrupt)
+			}
+			r[uint32(128+i)] = [][]byte{data[vardata+varend : vardata+int(end&0x7fff)]}
+			varend = int(end & 0x7fff)
+		}
+	}
+
+	// Tagged columns
+	tagstart := varoffset + 2*varcount + varend
+	if tagstart >= len(data) {
+		return r, nil
+	}
+	tagdata := data[tagstart:]
+	if len(tagdata) < 4 {
+		return nil, fmt.Errorf("tagged data too short: %w", ErrCorrupt)
+	}
+
+	type taggedentry struct {
+		id       uint32
+		offset   int
+		extended bool
+		null     bool
+	}
+	var entries []taggedentry
+
+	offsetmask := uint16(0x1fff)
+	if t.db.largepages {
+		offsetmask = 0x7fff
+	}
+	arraysize := int(binary.LittleEndian.Uint16(tagdata[2:]) & offsetmask)
+	if arraysize > len(tagdata) || arraysize%4 != 0 {
+		return nil, fmt.Errorf("tagged column array exceeds record: %w", ErrCorrupt)
+	}
+	for i := 0; i < arraysize; i += 4 {
+		raw := binary.LittleEndian.Uint16(tagdata[i+2:])
+		entry := taggedentry{
+			id:     uint32(binary.LittleEndian.Uint16(tagdata[i:])),
+			offset: int(raw & offsetmask),
+		}
+		if t.db.largepages {
+			entry.extended = true
+		} else {
+			entry.extended = raw&0x4000 != 0
+			entry.null = raw&0x2000 != 0
+		}
+		if entry.offset > len(tagdata) {
+			return nil, fmt.Errorf("tagged column %v exceeds record: %w", entry.id, ErrCorrupt)
+		}
+		entries = append(entries, entry)
+	}
+
+	for i, entry := range entries {
+		end := len(tagdata)
+		if i+1 < len(entries) {
+			end = entries[i+1].offset
+		}
+		if end < entry.offset {
+			return nil, fmt.Errorf("tagged column %v has negative size: %w", entry.id, ErrCorrupt)
+		}
+		value := tagdata[entry.offset:end]
+		if entry.null {
+			continue
+		}
+
+		var flags byte
+		if entry.extended && len(value) > 0 {
+			flags = value[0]
+			value = value[1:]
+		}
+		if flags&TAGGED_NULL != 0 {
+			continue
+		}
+
+		values, err := t.taggedValues(flags, value)
+		if err != nil {
+			return nil, fmt.Errorf("tagged column %v: %w", entry.id, err)
+		}
+		if len(values) > 0 {
+			r[entry.id] = values
+		}
+	}
+
+	return r, nil
+}
+
+func (t *Table) taggedValues(flags byte, value []byte) ([][]byte, error) {
+	var values [][]byte
+	var separated []bool
+
+	switch {
+	case flags&TAGGED_TWO_VALUES != 0:
+		if len(value) < 1 || int(value[0])+1 > len(value) {
+			return nil, ErrCorrupt
+		}
+		values = [][]byte{value[1 : 1+int(value[0])], value[1+int(value[0]):]}
+		separated = []bool{false, false}
+	case flags&TAGGED_MULTI_VALUE != 0:
+		if len(value) < 2 {
+			return nil, ErrCorrupt
+		}
+		headersize := int(binary.LittleEndian.Uint16(value) & 0x7fff)
+		if headersize > len(value) || headersize%2 != 0 {
+			return nil, ErrCorrupt
+		}
+		for i := 0; i < headersize; i += 2 {
+			raw := binary.LittleEndian.Uint16(value[i:])
+			start := int(raw & 0x7fff)
+			end := len(value)
+			if i+2 < headersize {
+				end = int(binary.LittleEndian.Uint16(value[i+2:]) & 0x7fff)
+			}
+			if start > end || end > len(value) {
+				return nil, ErrCorrupt
+			}
+			values = append(values, value[start:end])
+			separated = append(separated, raw&0x8000 != 0)
+		}
+	default:
+		values = [][]byte{value}
+		separated = []bool{flags&TAGGED_SEPARATED != 0}
+	}
+
+	for i := range values {
+		if separated[i] {
+			lv, err := t.longValue(values[i])
+			if err != nil {
+				return nil, err
+			}
+			values[i] = lv
+		} else if flags&TAGGED_COMPRESSED != 0 {
+			decompressed, err := Decompress(values[i])
+			if err != nil {
+				return nil, err
+			}
+			values[i] = decompressed
+		}
+	}
+	return values, nil
+}
+
+// longValue reassembles a value stored separately in the long value tree of the table
+func (t *Table) longValue(lid []byte) ([]byte, error) {
+	if t.lvindex == nil {
+		err := t.indexLongValues()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var key []byte
+	switch len(lid) {
+	case 4:
+		key = make([]byte, 4)
+		binary.BigEndian.PutUint32(key, binary.LittleEndian.Uint32(lid))
+	case 8:
+		key = make([]byte, 8)
+		binary.BigEndian.PutUint64(key, binary.LittleEndian.Uint64(lid))
+	default:
+		return nil, fmt.Errorf("invalid long value id length %v: %w", len(lid), ErrCorrupt)
+	}
+
+	segments, found := t.lvindex[string(key)]
+	if !found {
+		return nil, fmt.Errorf("long value %x not found: %w", key, ErrCorrupt)
+	}
+
+	var size uint32
+	var result []byte
+	for _, segment := range segments {
+		p, err := t.db.readPage(segment.page)
+		if err != nil {
+			return nil, err
+		}
+		_, _, data, err := t.db.entry(p, segment.tag)
+		if err != nil {
+			return nil, err
+		}
+		if segment.offset == 0xffffffff {
+			// Root of the long value, holds reference count and total size
+			if len(data) < 8 {
+				return nil, ErrCorrupt
+			}
+			size = binary.LittleEndian.Uint32(data[4:])
+			continue
+		}
+		if int(segment.offset) != len(result) {
+			return nil, fmt.Errorf("long value %x has gap at offset %v: %w", key, len(result), ErrCorrupt)
+		}
+		result = append(result, data...)
+	}
+	if uint32(len(result)) > size {
+		result = result[:size]
+	}
+	return result, nil
+}
+
+func (t *Table) indexLongValues() error {
+	t.lvindex = make(map[string][]lvsegment)
+	if t.LVPage == 0 {
+		return nil
+	}
+	err := t.db.walk(t.LVPage, func(p *page, index int, key, data []byte) error {
+		lidsize := 4
+		if len(key) > 0 && key[0]&0x80 != 0 {
+			lidsize = 8
+		}
+		switch len(key) {
+		case lidsize:
+			t.lvindex[string(key)] = append(t.lvindex[string(key)], lvsegment{offset: 0xffffffff, page: p.number, tag: index})
+		case lidsize + 4:
+			lid := string(key[:lidsize])
+			t.lvindex[lid] = append(t.lvindex[lid], lvsegment{offset: binary.BigEndian.Uint32(key[lidsize:]), page: p.number, tag: index})
+		}
+		return nil
+	})
+	for _, segments := range t.lvindex {
+		sort.Slice(segments, func(i, j int) bool {
+			// Root (0xffffffff) first, then segments by offset
+			if segments[i].offset == 0xffffffff {
+				return segments[j].offset != 0xffffffff
+			}
+			if segments[j].offset == 0xffffffff {
+				return false
+			}
+			return segments[i].offset < segments[j].offset
+		})
+	}
+	return err
+}
+
+// Helpers for decoding column values
+
+func (r Record) Bytes(c *Column) []byte {
+	if c == nil {
+		return nil
+	}
+	if v := r[c.ID]; len(v) > 0 {
+		return v[0]
+	}
+	return nil
+}
+
+func (r Record) Int32(c *Column) (int32, bool) {
+	v := r.Bytes(c)
+	if len(v) < 4 {
+		return 0, false
+	}
+	return int32(binary.LittleEndian.Uint32(v)), true
+}
+
+func (r Record) Int64(c *Column) (int64, bool) {
+	v := r.Bytes(c)
+	if len(v) < 8 {
+		return 0, false
+	}
+	return int64(binary.LittleEndian.Uint64(v)), true
+}
+
+func (r Record) Bool(c *Column) bool {
+	v := r.Bytes(c)
+	return len(v) > 0 && v[0] != 0
+}
+
+// DecodeUnicode converts UTF-16LE column data to a string
+func DecodeUnicode(data []byte) string {
+	u := make([]uint16, len(data)/2)
+	for i := range u {
+		u[i] = binary.LittleEndian.Uint16(data[i*2:])
+	}
+	for len(u) > 0 && u[len(u)-1] == 0 {
+		u = u[:len(u)-1]
+	}
+	return string(utf16.Decode(u))
+}
@@ -0,0 +1,121 @@
+package ese
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// fixturePage builds a page with the given tags, tag 0 first
+func fixturePage(db *Database, tags [][]byte, flags []uint16) *page {
+	p := &page{
+		number:     1,
+		data:       make([]byte, db.pagesize),
+		tags:       len(tags),
+		headersize: 40,
+	}
+	offset := 0
+	for i, tag := range tags {
+		copy(p.data[p.headersize+offset:], tag)
+		tagoffset := db.pagesize - 4*(i+1)
+		binary.LittleEndian.PutUint16(p.data[tagoffset:], uint16(len(tag)))
+		binary.LittleEndian.PutUint16(p.data[tagoffset+2:], uint16(offset)|flags[i]<<13)
+		offset += len(tag)
+	}
+	return p
+}
+
+func TestPageTags(t *testing.T) {
+	db := &Database{pagesize: 4096}
+	p := fixturePage(db, [][]byte{
+		[]byte("pre"), // Common key prefix
+		{0x02, 0x00, 'k', '1', 'd', 'a', 't', 'a'}, // Key "k1", data "data"
+		{0x02, 0x00, 0x01, 0x00, 'x', 'v'},         // Key prefix "pr" + "x", data "v"
+	}, []uint16{0, 0, TAG_COMMON})
+
+	tests := []struct {
+		index int
+		key   string
+		data  string
+	}{
+		{1, "k1", "data"},
+		{2, "prx", "v"},
+	}
+	for _, test := range tests {
+		_, key, data, err := db.entry(p, test.index)
+		if err != nil {
+			t.Fatalf("tag %v: unexpected error: %v", test.index, err)
+		}
+		if string(key) != test.key || string(data) != test.data {
+			t.Errorf("tag %v: expected key %q data %q, got %q %q", test.index, test.key, test.data, key, data)
+		}
+	}
+
+	if _, _, err := db.tag(p, 3); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("expected out of range tag to be corrupt, got %v", err)
+	}
+}
+
+func TestParseRecord(t *testing.T) {
+	db := &Database{pagesize: 4096}
+	table := &Table{
+		db: db,
+		Columns: []*Column{
+			{ID: 1, Name: "long", Type: JET_coltypLong},
+			{ID: 2, Name: "bit", Type: JET_coltypBit},
+			{ID: 128, Name: "binary", Type: JET_coltypBinary},
+			{ID: 256, Name: "multi", Type: JET_coltypLongBinary},
+			{ID: 257, Name: "tagged", Type: JET_coltypLongBinary},
+		},
+	}
+
+	record := func(nullbitmap byte) []byte {
+		var data []byte
+		data = append(data, 2, 128, 10, 0)      // Last fixed, last variable, variable offset
+		data = append(data, 0x2a, 0, 0, 0, 1)   // Fixed columns
+		data = append(data, nullbitmap)         // Fixed column null bitmap
+		data = append(data, 3, 0)               // Variable column end offsets
+		data = append(data, 'x', 'y', 'z')      // Variable data
+		data = append(data, 0, 1, 8, 0x40)      // Tagged column 256 at 8, extended flags
+		data = append(data, 1, 1, 17, 0)        // Tagged column 257 at 17
+		data = append(data, TAGGED_MULTI_VALUE) // Multi value flags
+		data = append(data, 4, 0, 6, 0, 'a', 'b', 'c', 'd')
+		data = append(data, 'h', 'i')
+		return data
+	}
+
+	r, err := table.parseRecord(record(0))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if v, ok := r.Int32(table.Columns[0]); !ok || v != 42 {
+		t.Errorf("expected fixed column 42, got %v %v", v, ok)
+	}
+	if !r.Bool(table.Columns[1]) {
+		t.Errorf("expected bit column to be set")
+	}
+	if v := r.Bytes(table.Columns[2]); string(v) != "xyz" {
+		t.Errorf("expected variable column xyz, got %q", v)
+	}
+	if v := r[256]; len(v) != 2 || !bytes.Equal(v[0], []byte("ab")) || !bytes.Equal(v[1], []byte("cd")) {
+		t.Errorf("expected multi value column [ab cd], got %q", v)
+	}
+	if v := r.Bytes(table.Columns[4]); string(v) != "hi" {
+		t.Errorf("expected tagged column hi, got %q", v)
+	}
+
+	// Null bit for column 2
+	r, err = table.parseRecord(record(0x02))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, found := r[2]; found {
+		t.Errorf("expected null fixed column to be absent")
+	}
+
+	// Truncated variable data
+	if _, err = table.parseRecord(record(0)[:13]); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("expected truncated record to be corrupt, got %v", err)
+	}
+}
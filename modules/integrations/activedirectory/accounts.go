@@ -0,0 +1,13 @@
+package activedirectory
+
+import "strings"
+
+// IsLocalSystemAccount returns true for SYSTEM, LOCAL SERVICE and NETWORK SERVICE, by SID or name. Running as
+// any of them gives control of the computer
+func IsLocalSystemAccount(account string) bool {
+	switch strings.ToUpper(account) {
+	case "S-1-5-18", "S-1-5-19", "S-1-5-20", "SYSTEM", "NT AUTHORITY\\SYSTEM", "LOCAL SERVICE", "NT AUTHORITY\\LOCAL SERVICE", "NT AUTHORITY\\LOCALSERVICE", "NETWORK SERVICE", "NT AUTHORITY\\NETWORK SERVICE", "NT AUTHORITY\\NETWORKSERVICE":
+		return true
+	}
+	return false
+}
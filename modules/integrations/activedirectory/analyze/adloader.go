@@ -1,6 +1,7 @@
 package analyze
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
@@ -46,6 +47,8 @@ type ADLoader struct {
 
 	shardobjects map[string]*engine.Objects
 
+	forests []activedirectory.ForestManifest
+
 	objectstoconvert chan convertqueueitem
 	importcnf        bool // Import CNF (conflict) objects (experimental)
 	importdel        bool // Import deleted objects (experimental)
@@ -149,6 +152,22 @@ func (ld *ADLoader) getShard(path string) *engine.Objects {
 }
 
 func (ld *ADLoader) Load(path string, cb engine.ProgressCallbackFunc) error {
+	if strings.HasSuffix(path, ".forest.json") {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("Problem reading forest manifest: %v", err)
+		}
+		var manifest activedirectory.ForestManifest
+		err = json.Unmarshal(raw, &manifest)
+		if err != nil {
+			return fmt.Errorf("Problem decoding forest manifest: %v", err)
+		}
+		ld.importmutex.Lock()
+		ld.forests = append(ld.forests, manifest)
+		ld.importmutex.Unlock()
+		return nil
+	}
+
 	if strings.HasSuffix(path, ".objects.msgp.lz4") {
 		ao := ld.getShard(path)
 
@@ -203,6 +222,7 @@ func (ld *ADLoader) Close() ([]*engine.Objects, error) {
 	ld.done.Wait()
 
 	var aos []*engine.Objects
+	loadeddomains := make(map[string]struct{})
 	for path, ao := range ld.shardobjects {
 		// Replace shard path value with the domain name the represents
 		rootdse, found := ao.Find(engine.ObjectClass, engine.AttributeValueString("rootdse"))
@@ -212,6 +232,7 @@ func (ld *ADLoader) Close() ([]*engine.Objects, error) {
 		}
 
 		domain := rootdse.OneAttrString(defaultNamingContext)
+		loadeddomains[strings.ToLower(domain)] = struct{}{}
 		domainval := engine.AttributeValueOne{Value: engine.AttributeValueString(domain)}
 
 		// Indicate from which domain we saw this
@@ -225,5 +246,19 @@ func (ld *ADLoader) Close() ([]*engine.Objects, error) {
 
 	ld.shardobjects = make(map[string]*engine.Objects) // Clear from memory
 
+	// Check that forest wide collections are complete
+	for _, forest := range ld.forests {
+		for _, domain := range forest.Domains {
+			if _, found := loadeddomains[strings.ToLower(domain.DistinguishedName)]; found {
+				continue
+			}
+			if domain.Error != "" {
+				log.Warn().Msgf("Domain %v in forest %v was not collected (%v), paths through it will be missing", domain.DNSRoot, forest.RootDomain, domain.Error)
+			} else {
+				log.Warn().Msgf("Domain %v in forest %v was collected, but not found in data", domain.DNSRoot, forest.RootDomain)
+			}
+		}
+	}
+
 	return aos, nil
 }
@@ -0,0 +1,90 @@
+package analyze
+
+import (
+	"strings"
+
+	"github.com/lkarlslund/adalanche/modules/engine"
+	"github.com/lkarlslund/adalanche/modules/integrations/activedirectory"
+	"github.com/rs/zerolog/log"
+)
+
+// adminSDHolderExclusions returns the mask of operator groups excluded from AdminSDHolder protection
+func adminSDHolderExclusions(ao *engine.Objects, domainpart string) int {
+	// Find dsHeuristics, this defines groups EXCLUDED From AdminSDHolder application
+	// https://social.technet.microsoft.com/wiki/contents/articles/22331.adminsdholder-protected-groups-and-security-descriptor-propagator.aspx#What_is_a_protected_group
+	if ds, found := ao.Find(engine.DistinguishedName, engine.AttributeValueString("CN=Directory Service,CN=Windows NT,CN=Services,CN=Configuration,"+domainpart)); found {
+		excluded := ds.OneAttrString(activedirectory.DsHeuristics)
+		if len(excluded) >= 16 {
+			return strings.Index("0123456789ABCDEF", strings.ToUpper(string(excluded[15])))
+		}
+	}
+	return 0
+}
+
+// isAdminSDHolderProtected returns true if the SDProp process stamps the AdminSDHolder ACL on this object and its members
+func isAdminSDHolderProtected(o *engine.Object, excluded_mask int) bool {
+	sid := o.SID()
+	if sid.IsNull() {
+		return false
+	}
+
+	switch sid.RID() {
+	case DOMAIN_USER_RID_ADMIN:
+	case DOMAIN_USER_RID_KRBTGT:
+	case DOMAIN_GROUP_RID_ADMINS:
+	case DOMAIN_GROUP_RID_CONTROLLERS:
+	case DOMAIN_GROUP_RID_SCHEMA_ADMINS:
+	case DOMAIN_GROUP_RID_ENTERPRISE_ADMINS:
+	case DOMAIN_GROUP_RID_READONLY_CONTROLLERS:
+	case DOMAIN_ALIAS_RID_ADMINS:
+	case DOMAIN_ALIAS_RID_ACCOUNT_OPS:
+		if excluded_mask&1 != 0 {
+			return false
+		}
+	case DOMAIN_ALIAS_RID_SYSTEM_OPS:
+		if excluded_mask&2 != 0 {
+			return false
+		}
+	case DOMAIN_ALIAS_RID_PRINT_OPS:
+		if excluded_mask&4 != 0 {
+			return false
+		}
+	case DOMAIN_ALIAS_RID_BACKUP_OPS:
+		if excluded_mask&8 != 0 {
+			return false
+		}
+	case DOMAIN_ALIAS_RID_REPLICATOR:
+	default:
+		// Not a protected group
+		return false
+	}
+
+	// Only domain groups
+	if sid.Component(2) != 21 && sid.Component(2) != 32 {
+		log.Debug().Msgf("RID match but not domain object for %v with SID %v", o.OneAttrString(engine.DistinguishedName), o.SID().String())
+		return false
+	}
+	return true
+}
+
+// aclDiff returns the ACEs that are only present in one of the ACLs, ignoring order
+func aclDiff(acl, template engine.ACL) (added, removed []engine.ACE) {
+	counts := make(map[engine.ACE]int)
+	for _, ace := range template.Entries {
+		counts[ace]++
+	}
+	for _, ace := range acl.Entries {
+		if counts[ace] > 0 {
+			counts[ace]--
+			continue
+		}
+		added = append(added, ace)
+	}
+	for _, ace := range template.Entries {
+		if counts[ace] > 0 {
+			counts[ace]--
+			removed = append(removed, ace)
+		}
+	}
+	return
+}
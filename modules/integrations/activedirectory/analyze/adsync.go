@@ -0,0 +1,65 @@
+package analyze
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/lkarlslund/adalanche/modules/engine"
+	"github.com/lkarlslund/adalanche/modules/integrations/activedirectory"
+)
+
+// Account name prefixes used by the different generations of Azure AD Connect / DirSync
+var adSyncAccountPrefixes = []string{"MSOL_", "AAD_", "Sync_"}
+
+var (
+	adSyncDescription = regexp.MustCompile(`(?i)(Azure Active Directory Connect|Azure AD Connect|Entra Connect|Synchronization Service)`)
+	adSyncServerName  = regexp.MustCompile(`(?i)running on computer ([^\s.,]+)`)
+	adSyncAccountName = regexp.MustCompile(`(?i)^Sync_(.+)_[0-9a-f]+$`)
+)
+
+// adSyncNameMatch returns true if the accounts sAMAccountName looks like one created by the AD Connect installer
+func adSyncNameMatch(o *engine.Object) bool {
+	name := o.OneAttrString(engine.SAMAccountName)
+	for _, prefix := range adSyncAccountPrefixes {
+		if len(name) > len(prefix) && strings.EqualFold(name[:len(prefix)], prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// adSyncDescriptionMatch returns true if the description was set by the AD Connect installer
+func adSyncDescriptionMatch(o *engine.Object) bool {
+	return adSyncDescription.MatchString(o.OneAttrString(activedirectory.Description))
+}
+
+// adSyncServer extracts the name of the server running AD Connect from the account description or name, if possible
+func adSyncServer(o *engine.Object) string {
+	if match := adSyncServerName.FindStringSubmatch(o.OneAttrString(activedirectory.Description)); match != nil {
+		return match[1]
+	}
+	if match := adSyncAccountName.FindStringSubmatch(o.OneAttrString(engine.SAMAccountName)); match != nil {
+		return match[1]
+	}
+	return ""
+}
+
+// hasReplicateAll returns true if the account, directly or through group membership, can replicate secrets from a domain
+func hasReplicateAll(o *engine.Object) bool {
+	for _, source := range append([]*engine.Object{o}, o.MemberOf(true)...) {
+		for target, methods := range source.CanPwn {
+			if target.Type() == engine.ObjectTypeDomainDNS && methods.IsSet(activedirectory.PwnDSReplicationGetChangesAll) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// computerName returns the short name of a computer, whether it came from AD or from localmachine data
+func computerName(o *engine.Object) string {
+	if name := o.OneAttrString(engine.SAMAccountName); name != "" {
+		return strings.TrimSuffix(name, "$")
+	}
+	return o.OneAttrString(activedirectory.Name)
+}
@@ -3,8 +3,8 @@ package analyze
 import (
 	"encoding/binary"
 	"fmt"
+	"math"
 	"sort"
-	"strconv"
 	"strings"
 	"time"
 
@@ -36,6 +36,7 @@ var (
 	AttributeProfilePathGUID, _                     = uuid.FromString("{bf967a05-0de6-11d0-a285-00aa003049e2}")
 	AttributeScriptPathGUID, _                      = uuid.FromString("{bf9679a8-0de6-11d0-a285-00aa003049e2}")
 	AttributeMSDSManagedPasswordId, _               = uuid.FromString("0e78295a-c6d3-0a40-b491-d62251ffa0a6")
+	AttributeDNSRecord, _                           = uuid.FromString("{e0fa1e69-9b45-11d0-afdd-00c04fd930c9}")
 
 	ExtendedRightCertificateEnroll, _ = uuid.FromString("0e10c968-78fb-11d2-90d4-00c04f79dc55")
 
@@ -49,6 +50,7 @@ var (
 	ObjectGuidGPO                = uuid.UUID{0xf3, 0x0e, 0x3b, 0xc2, 0x9f, 0xf0, 0x11, 0xd1, 0xb6, 0x03, 0x00, 0x00, 0xf8, 0x03, 0x67, 0xc1}
 	ObjectGuidOU                 = uuid.UUID{0xbf, 0x96, 0x7a, 0xa5, 0x0d, 0xe6, 0x11, 0xd0, 0xa2, 0x85, 0x00, 0xaa, 0x00, 0x30, 0x49, 0xe2}
 	ObjectGuidAttributeSchema, _ = uuid.FromString("{BF967A80-0DE6-11D0-A285-00AA003049E2}")
+	ObjectGuidDNSNode, _         = uuid.FromString("{e0fa1e8c-9b45-11d0-afdd-00c04fd930c9}")
 
 	AdministratorsSID, _           = windowssecurity.SIDFromString("S-1-5-32-544")
 	BackupOperatorsSID, _          = windowssecurity.SIDFromString("S-1-5-32-551")
@@ -66,7 +68,7 @@ var (
 
 var warnedgpos = make(map[string]struct{})
 
-var lapsguids []uuid.UUID
+var lapsguids, lapsencryptedguids []uuid.UUID
 
 func init() {
 	Loader.AddAnalyzers(
@@ -93,7 +95,7 @@ func init() {
 			Description: "Reading local admin passwords via LAPS",
 			ObjectAnalyzer: func(o *engine.Object, ao *engine.Objects) {
 				// Only if we've picked up some LAPS attribute GUIDs
-				if len(lapsguids) == 0 {
+				if len(lapsguids) == 0 && len(lapsencryptedguids) == 0 {
 					return
 				}
 
@@ -102,7 +104,7 @@ func init() {
 					return
 				}
 				// ... that has LAPS installed
-				if o.Attr(activedirectory.MSmcsAdmPwdExpirationTime).Len() == 0 {
+				if o.Attr(activedirectory.MSmcsAdmPwdExpirationTime).Len() == 0 && o.Attr(activedirectory.MSLAPSPwdExpirationTime).Len() == 0 {
 					return
 				}
 				// Analyze ACL
@@ -117,101 +119,33 @@ func init() {
 						}
 					}
 				}
-			},
-		},
 
-		engine.PwnAnalyzer{
-			// Method: activedirectory.PwnComputerAffectedByGPO,
-			Description: "Computers affected by a GPO",
-			ObjectAnalyzer: func(o *engine.Object, ao *engine.Objects) {
-				// Only for computers, you can't really pwn users this way
-				if o.Type() != engine.ObjectTypeComputer {
-					return
-				}
-				// Find all perent containers with GP links
-				var hasparent bool
-				p := o
-
-				// https://docs.microsoft.com/en-us/openspecs/windows_protocols/ms-gpol/5c7ecdad-469f-4b30-94b3-450b7fff868f
-				allowEnforcedGPOsOnly := false
-				for {
-					newparent := p.Parent()
-					var foundparent bool
-					if newparent != nil && newparent.DN() != "" && strings.HasSuffix(p.DN(), newparent.DN()) {
-						p = newparent
-						foundparent = true
-					}
-					if !foundparent {
-						// Fall back to old slow method of looking at DNs
-						p, hasparent = ao.DistinguishedParent(p)
-						if !hasparent {
-							break
-						}
+				// Windows LAPS encrypted passwords can only be decrypted by the authorized decryptor in the blob
+				var decryptors int
+				for _, attr := range []engine.Attribute{activedirectory.MSLAPSEncryptedPassword, activedirectory.MSLAPSEncryptedDSRMPwd} {
+					blob := o.OneAttrString(attr)
+					if blob == "" {
+						continue
 					}
-
-					var gpcachelinks engine.AttributeValues
-					var found bool
-					if gpcachelinks, found = p.Get(GPLinkCache); !found {
-						// the hard way
-						gpcachelinks = engine.NoValues{} // We assume there is nothing
-
-						gplinks := strings.Trim(p.OneAttrString(activedirectory.GPLink), " ")
-						if len(gplinks) != 0 {
-							// log.Debug().Msgf("GPlink for %v on container %v: %v", o.DN(), p.DN(), gplinks)
-							if !strings.HasPrefix(gplinks, "[") || !strings.HasSuffix(gplinks, "]") {
-								log.Error().Msgf("Error parsing gplink on %v: %v", o.DN(), gplinks)
-							} else {
-								links := strings.Split(gplinks[1:len(gplinks)-1], "][")
-
-								var collecteddata engine.AttributeValueSlice
-								for _, link := range links {
-									linkinfo := strings.Split(link, ";")
-									if len(linkinfo) != 2 {
-										log.Error().Msgf("Error parsing gplink on %v: %v", o.DN(), gplinks)
-										continue
-									}
-									linkedgpodn := linkinfo[0][7:] // strip LDAP:// prefix and link to this
-
-									gpo, found := ao.Find(engine.DistinguishedName, engine.AttributeValueString(linkedgpodn))
-									if !found {
-										if _, warned := warnedgpos[linkedgpodn]; !warned {
-											warnedgpos[linkedgpodn] = struct{}{}
-											log.Warn().Msgf("Object linked to GPO that is not found %v: %v", o.DN(), linkedgpodn)
-										}
-									} else {
-										linktype, _ := strconv.ParseInt(linkinfo[1], 10, 64)
-										collecteddata = append(collecteddata, engine.AttributeValueObject{
-											Object: gpo,
-										}, engine.AttributeValueInt(linktype))
-									}
-								}
-								gpcachelinks = collecteddata
-							}
-						}
-						p.Set(GPLinkCache, gpcachelinks)
+					encrypted, err := activedirectory.ParseLAPSEncryptedPassword([]byte(blob))
+					if err != nil {
+						log.Warn().Msgf("Problem decoding %v on %v: %v", attr.String(), o.DN(), err)
+						continue
 					}
+					o.SetValues(activedirectory.MetaLAPSAuthorizedDecryptor, engine.AttributeValueSID(encrypted.AuthorizedDecryptor))
+					ao.FindOrAddAdjacentSID(encrypted.AuthorizedDecryptor, o).Pwns(o, activedirectory.PwnDecryptLAPSPassword)
+					decryptors++
+				}
+				if decryptors > 0 {
+					return
+				}
 
-					// cached or generated - pairwise pointer to gpo object and int
-					gplinkslice := gpcachelinks.Slice()
-					for i := 0; i < gpcachelinks.Len(); i += 2 {
-						gpo := gplinkslice[i].Raw().(*engine.Object)
-						gpLinkOptions := gplinkslice[i+1].Raw().(int64)
-						// https://docs.microsoft.com/en-us/openspecs/windows_protocols/ms-gpol/08090b22-bc16-49f4-8e10-f27a8fb16d18
-						if gpLinkOptions&0x01 != 0 {
-							// GPO link is disabled
-							continue
-						}
-						if allowEnforcedGPOsOnly && gpLinkOptions&0x02 == 0 {
-							// Enforcement required, but this is not an enforced GPO
-							continue
+				// We couldn't see the blob, so assume readers are allowed to decrypt it (the default decryptor is Domain Admins)
+				for index, acl := range sd.DACL.Entries {
+					for _, objectGUID := range lapsencryptedguids {
+						if sd.DACL.AllowObjectClass(index, o, engine.RIGHT_DS_CONTROL_ACCESS, objectGUID, ao) {
+							ao.FindOrAddAdjacentSID(acl.SID, o).Pwns(o, activedirectory.PwnDecryptLAPSPassword)
 						}
-						gpo.Pwns(o, activedirectory.PwnAffectedByGPO)
-					}
-
-					gpoptions := p.OneAttrString(activedirectory.GPOptions)
-					if gpoptions == "1" {
-						// inheritance is blocked, so let's not forget that when moving up
-						allowEnforcedGPOsOnly = true
 					}
 				}
 			},
@@ -697,14 +631,38 @@ func init() {
 			},
 		},
 		engine.PwnAnalyzer{
-			// Method: activedirectory.PwnSIDHistoryEquality,
-			Description: "Indicates that object has a SID History attribute pointing to the other object, making them the 'same' permission wise",
+			// Method: activedirectory.PwnDNSWriteRecord,
+			Description: "Indicates that you can modify the DNS record of a computer",
 			ObjectAnalyzer: func(o *engine.Object, ao *engine.Objects) {
-				sids := o.Attr(activedirectory.SIDHistory).Slice()
-				for _, sidval := range sids {
-					if sid, ok := sidval.Raw().(windowssecurity.SID); ok {
-						target := ao.FindOrAddAdjacentSID(sid, o)
-						o.Pwns(target, activedirectory.PwnSIDHistoryEquality)
+				if o.Type() != engine.ObjectTypeDNSNode {
+					return
+				}
+				zone := o.Parent()
+				if zone == nil || zone.Type() != engine.ObjectTypeDNSZone {
+					return
+				}
+				name := o.OneAttrString(engine.Name)
+				if name == "" || name == "@" || name == "*" {
+					return
+				}
+				computers, found := ao.FindMulti(activedirectory.DNSHostName, engine.AttributeValueString(name+"."+zone.OneAttrString(engine.Name)))
+				if !found {
+					return
+				}
+				sd, err := o.SecurityDescriptor()
+				if err != nil {
+					return
+				}
+				for index, acl := range sd.DACL.Entries {
+					if sd.DACL.AllowObjectClass(index, o, engine.RIGHT_DS_WRITE_PROPERTY, AttributeDNSRecord, ao) {
+						source := ao.FindOrAddAdjacentSID(acl.SID, o)
+						for _, computer := range computers {
+							if source == computer {
+								// Computers update their own records
+								continue
+							}
+							source.Pwns(computer, activedirectory.PwnDNSWriteRecord)
+						}
 					}
 				}
 			},
@@ -926,17 +884,7 @@ func init() {
 			// We found it - so we know it can change ACLs of some objects
 			domainpart := adminsdholder.OneAttrString(engine.DomainPart)
 
-			// Are some groups excluded?
-			excluded_mask := 0
-
-			// Find dsHeuristics, this defines groups EXCLUDED From AdminSDHolder application
-			// https://social.technet.microsoft.com/wiki/contents/articles/22331.adminsdholder-protected-groups-and-security-descriptor-propagator.aspx#What_is_a_protected_group
-			if ds, found := ao.Find(engine.DistinguishedName, engine.AttributeValueString("CN=Directory Service,CN=Windows NT,CN=Services,CN=Configuration,"+domainpart)); found {
-				excluded := ds.OneAttrString(activedirectory.DsHeuristics)
-				if len(excluded) >= 16 {
-					excluded_mask = strings.Index("0123456789ABCDEF", strings.ToUpper(string(excluded[15])))
-				}
-			}
+			excluded_mask := adminSDHolderExclusions(ao, domainpart)
 
 			for _, o := range ao.Filter(func(o *engine.Object) bool {
 				// Check if object is a group
@@ -950,46 +898,7 @@ func init() {
 				}
 				return true
 			}).Slice() {
-
-				grpsid := o.SID()
-				if grpsid.IsNull() {
-					continue
-				}
-
-				switch grpsid.RID() {
-				case DOMAIN_USER_RID_ADMIN:
-				case DOMAIN_USER_RID_KRBTGT:
-				case DOMAIN_GROUP_RID_ADMINS:
-				case DOMAIN_GROUP_RID_CONTROLLERS:
-				case DOMAIN_GROUP_RID_SCHEMA_ADMINS:
-				case DOMAIN_GROUP_RID_ENTERPRISE_ADMINS:
-				case DOMAIN_GROUP_RID_READONLY_CONTROLLERS:
-				case DOMAIN_ALIAS_RID_ADMINS:
-				case DOMAIN_ALIAS_RID_ACCOUNT_OPS:
-					if excluded_mask&1 != 0 {
-						continue
-					}
-				case DOMAIN_ALIAS_RID_SYSTEM_OPS:
-					if excluded_mask&2 != 0 {
-						continue
-					}
-				case DOMAIN_ALIAS_RID_PRINT_OPS:
-					if excluded_mask&4 != 0 {
-						continue
-					}
-				case DOMAIN_ALIAS_RID_BACKUP_OPS:
-					if excluded_mask&8 != 0 {
-						continue
-					}
-				case DOMAIN_ALIAS_RID_REPLICATOR:
-				default:
-					// Not a protected group
-					continue
-				}
-
-				// Only domain groups
-				if grpsid.Component(2) != 21 && grpsid.Component(2) != 32 {
-					log.Debug().Msgf("RID match but not domain object for %v with SID %v", o.OneAttrString(engine.DistinguishedName), o.SID().String())
+				if !isAdminSDHolderProtected(o, excluded_mask) {
 					continue
 				}
 
@@ -1031,6 +940,262 @@ func init() {
 		engine.BeforeMerge,
 	)
 
+	Loader.AddProcessor(func(ao *engine.Objects) {
+		// Changes are kept as "<attribute> <time> <originating DC>" values in one attribute, as registering
+		// an attribute per replicated attribute name would bloat the global attribute table. Link changes
+		// on the target get the DN of the object holding the link appended. The few changes we query on
+		// get their own typed attributes
+		replchange := func(name string, changed time.Time, dc string) string {
+			return name + " " + changed.UTC().Format(time.RFC3339) + " " + dc
+		}
+		linkchanges := make(map[*engine.Object][]engine.AttributeValue)
+		memberofchanges := make(map[*engine.Object]time.Time)
+
+		for _, o := range ao.Filter(func(o *engine.Object) bool {
+			return o.HasAttr(activedirectory.MSDSReplAttributeMetaData) || o.HasAttr(activedirectory.MSDSReplValueMetaData)
+		}).Slice() {
+			var lastchange, sdchange, memberchange time.Time
+			var changes []engine.AttributeValue
+			for _, value := range o.Attr(activedirectory.MSDSReplAttributeMetaData).Slice() {
+				md, err := activedirectory.ParseReplAttributeMetaData(value.String())
+				if err != nil {
+					log.Debug().Msgf("Problem parsing attribute replication metadata on %v: %v", o.DN(), err)
+					continue
+				}
+				changes = append(changes, engine.AttributeValueString(replchange(md.AttributeName, md.LastOriginatingChange, md.OriginatingDC())))
+				switch strings.ToLower(md.AttributeName) {
+				case "ntsecuritydescriptor":
+					sdchange = md.LastOriginatingChange
+				case "member":
+					// Legacy (non LVR) groups only have attribute level metadata for members
+					memberchange = md.LastOriginatingChange
+				}
+				if !md.IsBookkeeping() && md.LastOriginatingChange.After(lastchange) {
+					lastchange = md.LastOriginatingChange
+				}
+			}
+
+			// Linked values, the target gets to know when it was linked and from where
+			for _, value := range o.Attr(activedirectory.MSDSReplValueMetaData).Slice() {
+				md, err := activedirectory.ParseReplValueMetaData(value.String())
+				if err != nil {
+					log.Debug().Msgf("Problem parsing value replication metadata on %v: %v", o.DN(), err)
+					continue
+				}
+				if md.IsDeleted() {
+					continue
+				}
+				if md.LastOriginatingChange.After(lastchange) {
+					lastchange = md.LastOriginatingChange
+				}
+				ismember := strings.EqualFold(md.AttributeName, "member")
+				if ismember && md.LastOriginatingChange.After(memberchange) {
+					memberchange = md.LastOriginatingChange
+				}
+				if target, found := ao.Find(engine.DistinguishedName, engine.AttributeValueString(md.ObjectDN)); found {
+					linkchanges[target] = append(linkchanges[target], engine.AttributeValueString(replchange(md.AttributeName, md.LastOriginatingChange, md.OriginatingDC())+" "+o.DN()))
+					if ismember && md.LastOriginatingChange.After(memberofchanges[target]) {
+						memberofchanges[target] = md.LastOriginatingChange
+					}
+				}
+			}
+
+			if len(changes) > 0 {
+				o.SetValues(activedirectory.MetaReplChanges, changes...)
+			}
+			if !lastchange.IsZero() {
+				o.SetValues(activedirectory.MetaLastChange, engine.AttributeValueTime(lastchange))
+			}
+			if !sdchange.IsZero() {
+				o.SetValues(activedirectory.MetaSecurityDescriptorChange, engine.AttributeValueTime(sdchange))
+			}
+			if !memberchange.IsZero() {
+				o.SetValues(activedirectory.MetaMemberChange, engine.AttributeValueTime(memberchange))
+			}
+		}
+
+		for target, changes := range linkchanges {
+			target.SetValues(activedirectory.MetaLinkChanges, changes...)
+		}
+		for target, changed := range memberofchanges {
+			target.SetValues(activedirectory.MetaMemberOfChange, engine.AttributeValueTime(changed))
+		}
+	},
+		"replication metadata",
+		engine.BeforeMerge,
+	)
+
+	Loader.AddProcessor(func(ao *engine.Objects) {
+		findgroup := func(sid windowssecurity.SID, domainpart engine.AttributeValue) *engine.Object {
+			if group, found := ao.FindTwo(engine.ObjectSid, engine.AttributeValueSID(sid), engine.DomainPart, domainpart); found {
+				return group
+			}
+			return nil
+		}
+
+		for _, o := range ao.Filter(func(o *engine.Object) bool {
+			switch o.Type() {
+			case engine.ObjectTypeUser, engine.ObjectTypeGroup, engine.ObjectTypeComputer:
+				return true
+			}
+			return false
+		}).Slice() {
+			domainpart := o.OneAttr(engine.DomainPart)
+			if domainpart == nil {
+				continue
+			}
+			uac, _ := o.AttrInt(activedirectory.UserAccountControl)
+			if o.Type() == engine.ObjectTypeComputer && uac&engine.UAC_SERVER_TRUST_ACCOUNT != 0 {
+				// Domain Controller
+				if group := findgroup(BackupOperatorsSID, domainpart); group != nil {
+					group.Pwns(o, activedirectory.PwnBackupOperator)
+				}
+				if group := findgroup(ServerOperatorsSID, domainpart); group != nil {
+					group.Pwns(o, activedirectory.PwnServerOperator)
+				}
+				if group := findgroup(PrintOperatorsSID, domainpart); group != nil {
+					group.Pwns(o, activedirectory.PwnPrintOperator)
+				}
+				if group := findgroup(windowssecurity.AccountOperatorsSID, domainpart); group != nil {
+					group.Pwns(o, activedirectory.PwnAccountOperator)
+				}
+				// DnsAdmins has no fixed RID
+				if group, found := ao.FindTwo(engine.SAMAccountName, engine.AttributeValueString("DnsAdmins"), engine.DomainPart, domainpart); found {
+					group.Pwns(o, activedirectory.PwnDnsAdmin)
+				}
+				continue
+			}
+
+			// Account Operators can modify everything not protected by AdminSDHolder
+			if admincount, _ := o.AttrInt(activedirectory.AdminCount); admincount == 1 {
+				continue
+			}
+			if o.SID().Component(2) != 21 {
+				continue
+			}
+			if group := findgroup(windowssecurity.AccountOperatorsSID, domainpart); group != nil {
+				group.Pwns(o, activedirectory.PwnAccountOperator)
+			}
+		}
+	},
+		"privileged built-in groups",
+		engine.BeforeMerge,
+	)
+
+	Loader.AddProcessor(func(ao *engine.Objects) {
+		// Registered devices (msDS-Device objects) legitimately have key credentials
+		registereddevices := make(map[uuid.UUID]struct{})
+		for _, device := range ao.Filter(func(o *engine.Object) bool {
+			return o.HasAttr(activedirectory.MSDSDeviceID)
+		}).Slice() {
+			if deviceid, ok := device.OneAttrRaw(activedirectory.MSDSDeviceID).(uuid.UUID); ok {
+				registereddevices[deviceid] = struct{}{}
+			}
+		}
+
+		for _, o := range ao.Filter(func(o *engine.Object) bool {
+			return o.HasAttr(activedirectory.MSDSKeyCredentialLink)
+		}).Slice() {
+			admincount, _ := o.AttrInt(activedirectory.AdminCount)
+			privileged := admincount == 1
+			var keyids, created, deviceids []engine.AttributeValue
+			for _, value := range o.Attr(activedirectory.MSDSKeyCredentialLink).Slice() {
+				kc, err := activedirectory.ParseKeyCredentialLink(value.String())
+				if err != nil {
+					log.Warn().Msgf("Problem decoding key credential on %v: %v", o.DN(), err)
+					continue
+				}
+				keyids = append(keyids, engine.AttributeValueString(kc.KeyIDString()))
+				if !kc.Created.IsZero() {
+					created = append(created, engine.AttributeValueTime(kc.Created))
+				}
+				if !kc.DeviceID.IsNil() {
+					deviceids = append(deviceids, engine.AttributeValueGUID(kc.DeviceID))
+				}
+				if _, found := registereddevices[kc.DeviceID]; privileged && !found {
+					log.Warn().Msgf("Privileged account %v has key credential %v created %v without a registered device, this could be shadow credentials", o.DN(), kc.KeyIDString(), kc.Created)
+					o.SetValues(activedirectory.MetaUnregisteredKeyCredential, engine.AttributeValueInt(1))
+				}
+			}
+			if len(keyids) > 0 {
+				o.SetValues(activedirectory.MetaKeyCredentialID, keyids...)
+			}
+			if len(created) > 0 {
+				o.SetValues(activedirectory.MetaKeyCredentialCreated, created...)
+			}
+			if len(deviceids) > 0 {
+				o.SetValues(activedirectory.MetaKeyCredentialDeviceID, deviceids...)
+			}
+		}
+	},
+		"existing key credentials",
+		engine.BeforeMerge,
+	)
+
+	Loader.AddProcessor(func(ao *engine.Objects) {
+		for _, domain := range ao.Filter(func(o *engine.Object) bool {
+			return o.Type() == engine.ObjectTypeDomainDNS
+		}).Slice() {
+			domainsid := domain.SID()
+			if domainsid.IsNull() {
+				continue
+			}
+
+			// Stand-in for any computer account someone could add, so rights granted to these groups are reachable
+			newcomputer := engine.NewObject(
+				engine.DistinguishedName, "CN=New Computer Account,CN=Computers,"+domain.DN(),
+				engine.Name, "New Computer Account",
+				engine.ObjectCategorySimple, "Computer",
+				engine.DomainPart, domain.DN(),
+				engine.MetaDataSource, "Autogenerated",
+			)
+			ao.Add(newcomputer)
+
+			if domaincomputers, found := ao.Find(engine.ObjectSid, engine.AttributeValueSID(domainsid.AddComponent(515))); found {
+				newcomputer.Pwns(domaincomputers, activedirectory.PwnMemberOfGroup)
+			}
+			for _, sid := range []windowssecurity.SID{windowssecurity.AuthenticatedUsersSID, windowssecurity.EveryoneSID} {
+				if group := FindWellKnown(ao, sid); group != nil {
+					newcomputer.Pwns(group, activedirectory.PwnMemberOfGroup)
+				}
+			}
+
+			// Default is 10 if the attribute was not collected
+			quota, found := domain.AttrInt(activedirectory.MSDSMachineAccountQuota)
+			if !found {
+				quota = 10
+			}
+			if quota > 0 {
+				log.Info().Msgf("Machine account quota for %v is %v, so any authenticated user can add computers", domain.DN(), quota)
+				if authenticatedusers := FindWellKnown(ao, windowssecurity.AuthenticatedUsersSID); authenticatedusers != nil {
+					authenticatedusers.Pwns(newcomputer, activedirectory.PwnAddComputer)
+				}
+			}
+
+			// Create child rights for computers on containers in this domain
+			for _, container := range ao.Filter(func(o *engine.Object) bool {
+				switch o.Type() {
+				case engine.ObjectTypeDomainDNS, engine.ObjectTypeOrganizationalUnit, engine.ObjectTypeContainer:
+					return strings.EqualFold(o.OneAttrString(engine.DomainPart), domain.DN())
+				}
+				return false
+			}).Slice() {
+				sd, err := container.SecurityDescriptor()
+				if err != nil {
+					continue
+				}
+				for index, acl := range sd.DACL.Entries {
+					if sd.DACL.AllowObjectClass(index, container, engine.RIGHT_DS_CREATE_CHILD, ObjectGuidComputer, ao) {
+						ao.FindOrAddAdjacentSID(acl.SID, container).Pwns(newcomputer, activedirectory.PwnAddComputer)
+					}
+				}
+			}
+		}
+	},
+		"machine account quota and computer creation rights",
+		engine.BeforeMerge,
+	)
+
 	Loader.AddProcessor(func(ao *engine.Objects) {
 		// Generate member of chains
 		processbar := progressbar.NewOptions(int(len(ao.Slice())),
@@ -1125,6 +1290,12 @@ func init() {
 			if object.Attr(activedirectory.MSmcsAdmPwdExpirationTime).Len() > 0 {
 				object.SetValues(engine.MetaLAPSInstalled, engine.AttributeValueInt(1))
 			}
+			if object.Attr(activedirectory.MSLAPSPwdExpirationTime).Len() > 0 {
+				object.SetValues(engine.MetaWindowsLAPSInstalled, engine.AttributeValueInt(1))
+			}
+			if object.Type() == engine.ObjectTypeComputer && !object.HasAttr(engine.MetaLAPSInstalled) && !object.HasAttr(engine.MetaWindowsLAPSInstalled) {
+				object.SetValues(engine.MetaNoLAPS, engine.AttributeValueInt(1))
+			}
 			if uac, ok := object.AttrInt(activedirectory.UserAccountControl); ok {
 				if uac&engine.UAC_TRUSTED_FOR_DELEGATION != 0 {
 					object.SetValues(engine.MetaUnconstrainedDelegation, engine.AttributeValueInt(1))
@@ -1188,21 +1359,21 @@ func init() {
 
 			if object.Type() == engine.ObjectTypeTrust {
 				// http://www.frickelsoft.net/blog/?p=211
-				var direction string
-				dir, _ := object.AttrInt(activedirectory.TrustDirection)
-				switch dir {
-				case 0:
-					direction = "disabled"
-				case 1:
-					direction = "incoming"
-				case 2:
-					direction = "outgoing"
-				case 3:
-					direction = "bidirectional"
-				}
-				attr, _ := object.AttrInt(activedirectory.TrustAttributes)
-				log.Info().Msgf("Domain has a %v trust with %v", direction, object.OneAttr(activedirectory.TrustPartner))
-				if dir&2 != 0 && attr&0x08 != 0 && attr&0x40 != 0 {
+				ti := getTrustInfo(object)
+				if ti.SIDFiltering() {
+					object.SetValues(activedirectory.MetaTrustSIDFiltering, engine.AttributeValueInt(1))
+				}
+				if ti.SelectiveAuthentication() {
+					object.SetValues(activedirectory.MetaTrustSelectiveAuthentication, engine.AttributeValueInt(1))
+				}
+				if ti.TGTDelegation() {
+					object.SetValues(activedirectory.MetaTrustTGTDelegation, engine.AttributeValueInt(1))
+				}
+				if ti.Transitive() {
+					object.SetValues(activedirectory.MetaTrustTransitive, engine.AttributeValueInt(1))
+				}
+				log.Info().Msgf("Domain has a %v %v trust with %v", ti.Direction(), ti.Kind(), object.OneAttr(activedirectory.TrustPartner))
+				if ti.direction&activedirectory.TRUST_DIRECTION_OUTBOUND != 0 && !ti.SIDFiltering() {
 					log.Info().Msgf("SID filtering is not enabled, so pwn %v and pwn this AD too", object.OneAttr(activedirectory.TrustPartner))
 				}
 			}
@@ -1215,6 +1386,11 @@ func init() {
 					case "ms-Mcs-AdmPwd":
 						log.Info().Msg("Detected LAPS schema extension, adding this to LAPS analyzer")
 						lapsguids = append(lapsguids, objectGUID)
+					case "ms-LAPS-Password":
+						log.Info().Msg("Detected Windows LAPS schema extension, adding this to LAPS analyzer")
+						lapsguids = append(lapsguids, objectGUID)
+					case "ms-LAPS-EncryptedPassword", "ms-LAPS-EncryptedPasswordHistory", "ms-LAPS-EncryptedDSRMPassword", "ms-LAPS-EncryptedDSRMPasswordHistory":
+						lapsencryptedguids = append(lapsencryptedguids, objectGUID)
 					}
 				}
 			} /* else if object.HasAttrValue(engine.ObjectClass, "classSchema") {
@@ -1242,6 +1418,59 @@ func init() {
 		engine.BeforeMerge,
 	)
 
+	Loader.AddProcessor(func(ao *engine.Objects) {
+		// Index computers by every DNS suffix of their host name, so each zone is a single lookup
+		type zonehost struct {
+			host     string
+			computer *engine.Object
+		}
+		bysuffix := make(map[string][]zonehost)
+		for _, computer := range ao.Slice() {
+			if computer.Type() != engine.ObjectTypeComputer {
+				continue
+			}
+			labels := strings.Split(strings.ToLower(computer.OneAttrString(activedirectory.DNSHostName)), ".")
+			for i := 1; i < len(labels); i++ {
+				suffix := strings.Join(labels[i:], ".")
+				bysuffix[suffix] = append(bysuffix[suffix], zonehost{
+					host:     strings.Join(labels[:i], "."),
+					computer: computer,
+				})
+			}
+		}
+
+		for _, o := range ao.Slice() {
+			if o.Type() != engine.ObjectTypeDNSZone {
+				continue
+			}
+			sd, err := o.SecurityDescriptor()
+			if err != nil {
+				continue
+			}
+
+			// Computers in this zone without a record can be hijacked by creating it
+			var unregistered []*engine.Object
+			for _, zh := range bysuffix[strings.ToLower(o.OneAttrString(engine.Name))] {
+				if _, found := ao.Find(engine.DistinguishedName, engine.AttributeValueString("DC="+zh.host+","+o.DN())); !found {
+					unregistered = append(unregistered, zh.computer)
+				}
+			}
+
+			for index, acl := range sd.DACL.Entries {
+				if sd.DACL.AllowObjectClass(index, o, engine.RIGHT_DS_CREATE_CHILD, ObjectGuidDNSNode, ao) {
+					source := ao.FindOrAddAdjacentSID(acl.SID, o)
+					source.Pwns(o, activedirectory.PwnDNSCreateRecord)
+					for _, computer := range unregistered {
+						source.Pwns(computer, activedirectory.PwnDNSCreateRecord)
+					}
+				}
+			}
+		}
+	},
+		"Creating records in AD integrated DNS zones",
+		engine.BeforeMerge,
+	)
+
 	Loader.AddProcessor(func(ao *engine.Objects) {
 		// Find all the DomainDNS objects, and find the domain object
 		domains := make(map[string]windowssecurity.SID)
@@ -1398,6 +1627,20 @@ func init() {
 				continue
 			}
 			if sid.Component(2) == 21 {
+				if domain, found := findDomain(ao, sid.StripRID()); found {
+					// The resource domain holding the FSP needs to trust the domain the principal is from
+					if resourcedomain, found := ao.Find(engine.DistinguishedName, engine.AttributeValueString(foreign.OneAttrString(engine.DomainPart))); found {
+						if ti, found := findTrust(ao, resourcedomain.SID(), domain.SID()); found {
+							if ti.direction == 0 {
+								log.Debug().Msgf("Trust for foreign security principal %v is disabled, not linking it", foreign.DN())
+								continue
+							}
+							if ti.SelectiveAuthentication() {
+								foreign.SetValues(activedirectory.MetaTrustSelectiveAuthentication, engine.AttributeValueInt(1))
+							}
+						}
+					}
+				}
 				if sources, found := ao.FindMulti(engine.ObjectSid, engine.AttributeValueSID(sid)); found {
 					for _, source := range sources {
 						if source.Type() != engine.ObjectTypeForeignSecurityPrincipal {
@@ -1413,6 +1656,727 @@ func init() {
 		engine.AfterMerge,
 	)
 
+	Loader.AddProcessor(func(ao *engine.Objects) {
+		for _, o := range ao.Filter(func(o *engine.Object) bool {
+			return o.HasAttr(activedirectory.SIDHistory)
+		}).Slice() {
+			accountdomain := o.SID().StripRID()
+			for _, sidval := range o.Attr(activedirectory.SIDHistory).Slice() {
+				sid, ok := sidval.Raw().(windowssecurity.SID)
+				if !ok {
+					continue
+				}
+				if sid.Component(2) == 21 && !o.SID().IsNull() && sid.StripRID() != accountdomain {
+					// The domain the SID is from must trust us, and not filter the SID on the way in
+					if ti, found := findTrust(ao, sid.StripRID(), accountdomain); found && !ti.SIDFilterAllows(sid) {
+						log.Debug().Msgf("SID history %v on %v is filtered by the %v trust with %v", sid, o.DN(), ti.Kind(), ti.object.OneAttrString(activedirectory.TrustPartner))
+						continue
+					}
+				}
+				target := ao.FindOrAddAdjacentSID(sid, o)
+				o.Pwns(target, activedirectory.PwnSIDHistoryEquality)
+			}
+		}
+	}, "SID history equality across trusts",
+		engine.AfterMerge,
+	)
+
+	Loader.AddProcessor(func(ao *engine.Objects) {
+		// Values are plain DNs, or DN-String / DN-Binary (S:len:value:DN or B:len:value:DN)
+		resolve := func(o *engine.Object, attr engine.Attribute) []*engine.Object {
+			var results []*engine.Object
+			for _, value := range o.Attr(attr).Slice() {
+				dn := value.String()
+				if strings.HasPrefix(dn, "B:") || strings.HasPrefix(dn, "S:") {
+					if parts := strings.SplitN(dn, ":", 4); len(parts) == 4 {
+						dn = parts[3]
+					}
+				}
+				if target, found := ao.Find(engine.DistinguishedName, engine.AttributeValueString(dn)); found {
+					results = append(results, target)
+				} else {
+					log.Debug().Msgf("Could not resolve %v %v on %v", attr.String(), dn, o.DN())
+				}
+			}
+			return results
+		}
+		// Accounts are the principals themselves, or the recursive members of groups
+		accounts := func(principals []*engine.Object) map[*engine.Object]struct{} {
+			results := make(map[*engine.Object]struct{})
+			for _, principal := range principals {
+				for _, account := range append(principal.Members(true), principal) {
+					switch account.Type() {
+					case engine.ObjectTypeUser, engine.ObjectTypeComputer, engine.ObjectTypeManagedServiceAccount, engine.ObjectTypeGroupManagedServiceAccount:
+						results[account] = struct{}{}
+					}
+				}
+			}
+			return results
+		}
+
+		for _, rodc := range ao.Filter(func(o *engine.Object) bool {
+			uac, ok := o.AttrInt(activedirectory.UserAccountControl)
+			return o.Type() == engine.ObjectTypeComputer && ok && uac&engine.UAC_PARTIAL_SECRETS_ACCOUNT != 0
+		}).Slice() {
+			rodc.SetValues(activedirectory.MetaRODC, engine.AttributeValueInt(1))
+
+			// Delegated RODC administrators are local admins on the RODC
+			for _, admin := range resolve(rodc, activedirectory.ManagedBy) {
+				admin.Pwns(rodc, activedirectory.PwnLocalAdminRights)
+			}
+
+			neverreveal := accounts(resolve(rodc, activedirectory.MSDSNeverRevealGroup))
+
+			for account := range accounts(resolve(rodc, activedirectory.MSDSRevealedList)) {
+				rodc.Pwns(account, activedirectory.PwnRODCCachedCredentials)
+			}
+
+			for account := range accounts(resolve(rodc, activedirectory.MSDSRevealOnDemandGroup)) {
+				if _, denied := neverreveal[account]; denied {
+					continue
+				}
+				rodc.Pwns(account, activedirectory.PwnRODCRevealOnDemand)
+				account.SetValues(activedirectory.MetaRODCRevealable, engine.AttributeValueInt(1))
+				if admincount, _ := account.AttrInt(activedirectory.AdminCount); admincount == 1 {
+					log.Warn().Msgf("Privileged account %v can have its credentials cached on RODC %v", account.DN(), rodc.DN())
+					account.SetValues(activedirectory.MetaRODCRevealablePrivileged, engine.AttributeValueInt(1))
+				}
+			}
+		}
+	}, "RODC password replication policy",
+		engine.AfterMerge,
+	)
+
+	Loader.AddProcessor(func(ao *engine.Objects) {
+		for _, adminsdholder := range ao.Filter(func(o *engine.Object) bool {
+			return strings.HasPrefix(o.OneAttrString(engine.DistinguishedName), "CN=AdminSDHolder,CN=System,")
+		}).Slice() {
+			domainpart := adminsdholder.OneAttrString(engine.DomainPart)
+			template, err := adminsdholder.SecurityDescriptor()
+			if err != nil {
+				log.Warn().Msgf("Could not parse security descriptor of %v: %v", adminsdholder.DN(), err)
+				continue
+			}
+			excluded_mask := adminSDHolderExclusions(ao, domainpart)
+
+			// Objects that SDProp currently protects
+			protected := make(map[*engine.Object]struct{})
+			for _, o := range ao.Filter(func(o *engine.Object) bool {
+				return o.OneAttrString(engine.DomainPart) == domainpart && (o.Type() == engine.ObjectTypeGroup || o.Type() == engine.ObjectTypeUser)
+			}).Slice() {
+				if !isAdminSDHolderProtected(o, excluded_mask) {
+					continue
+				}
+				protected[o] = struct{}{}
+				if o.Type() == engine.ObjectTypeGroup {
+					for _, member := range o.Members(true) {
+						if member.OneAttrString(engine.DomainPart) == domainpart {
+							protected[member] = struct{}{}
+						}
+					}
+				}
+			}
+
+			var drifted int
+			for o := range protected {
+				sd, err := o.SecurityDescriptor()
+				if err != nil {
+					continue
+				}
+				if sd.Equals(template) {
+					continue
+				}
+				added, removed := aclDiff(sd.DACL, template.DACL)
+				if len(added) == 0 && len(removed) == 0 {
+					// Only owner or control flags differ
+					continue
+				}
+				drifted++
+				o.SetValues(activedirectory.MetaAdminSDHolderDrift, engine.AttributeValueInt(len(added)+len(removed)))
+				log.Warn().Msgf("Protected object %v has %v ACEs not in AdminSDHolder and lacks %v of its ACEs", o.DN(), len(added), len(removed))
+				for _, ace := range added {
+					log.Debug().Msgf("Extra ACE on %v: %v", o.DN(), ace.String(ao))
+				}
+				for _, ace := range removed {
+					log.Debug().Msgf("Missing ACE on %v: %v", o.DN(), ace.String(ao))
+				}
+			}
+
+			// adminCount is never cleared by SDProp, so former members keep their protected ACL
+			var orphaned int
+			for _, o := range ao.Filter(func(o *engine.Object) bool {
+				admincount, _ := o.AttrInt(activedirectory.AdminCount)
+				return admincount == 1 && o.OneAttrString(engine.DomainPart) == domainpart
+			}).Slice() {
+				if _, found := protected[o]; found {
+					continue
+				}
+				orphaned++
+				o.SetValues(activedirectory.MetaOrphanedAdminCount, engine.AttributeValueInt(1))
+				log.Info().Msgf("Object %v has adminCount set, but is not a member of any protected group", o.DN())
+			}
+
+			if drifted > 0 || orphaned > 0 {
+				log.Warn().Msgf("AdminSDHolder in %v: %v of %v protected objects have drifted ACLs, %v objects have orphaned adminCount", domainpart, drifted, len(protected), orphaned)
+			}
+		}
+	}, "AdminSDHolder drift and orphaned adminCount",
+		engine.AfterMerge,
+	)
+
+	Loader.AddProcessor(func(ao *engine.Objects) {
+		var accounts []*engine.Object
+		for _, o := range ao.Filter(func(o *engine.Object) bool {
+			return o.Type() == engine.ObjectTypeUser
+		}).Slice() {
+			namematch := adSyncNameMatch(o)
+			descmatch := adSyncDescriptionMatch(o)
+			if !namematch && !descmatch {
+				continue
+			}
+			// A name match alone is too weak, so require the replication rights the connector needs
+			if !descmatch && !hasReplicateAll(o) {
+				continue
+			}
+			o.SetValues(activedirectory.MetaADSyncAccount, engine.AttributeValueInt(1))
+			accounts = append(accounts, o)
+		}
+		if len(accounts) == 0 {
+			return
+		}
+
+		// Servers with the ADSync service from localmachine data
+		var servers []*engine.Object
+		for _, service := range ao.Filter(func(o *engine.Object) bool {
+			return o.Type() == engine.ObjectTypeService && strings.EqualFold(o.OneAttrString(activedirectory.Name), "ADSync")
+		}).Slice() {
+			for host := range service.PwnableBy {
+				if host.Type() == engine.ObjectTypeComputer {
+					servers = append(servers, host)
+				}
+			}
+		}
+
+		for _, account := range accounts {
+			servername := adSyncServer(account)
+
+			var found []string
+			for _, server := range servers {
+				if servername != "" && !strings.EqualFold(computerName(server), servername) {
+					continue
+				}
+				server.SetValues(activedirectory.MetaADSyncServer, engine.AttributeValueInt(1))
+				server.Pwns(account, activedirectory.PwnHasSyncCredentials)
+				found = append(found, computerName(server))
+			}
+
+			if len(found) == 0 && servername != "" {
+				// No localmachine data, so trust the server name the installer left behind
+				if computers, ok := ao.FindMulti(engine.SAMAccountName, engine.AttributeValueString(servername+"$")); ok {
+					for _, server := range computers {
+						if server.Type() != engine.ObjectTypeComputer {
+							continue
+						}
+						server.SetValues(activedirectory.MetaADSyncServer, engine.AttributeValueInt(1))
+						server.Pwns(account, activedirectory.PwnHasSyncCredentials)
+						found = append(found, computerName(server))
+					}
+				}
+			}
+
+			if len(found) > 0 {
+				log.Info().Msgf("Azure AD Connect account %v has credentials stored on %v", account.DN(), strings.Join(found, ", "))
+			} else {
+				log.Info().Msgf("Azure AD Connect account %v found, but could not locate the server storing its credentials", account.DN())
+			}
+		}
+	}, "Azure AD Connect synchronization accounts",
+		engine.AfterMerge,
+	)
+
+	Loader.AddProcessor(func(ao *engine.Objects) {
+		// Domain controllers are placed in sites by their server objects, everything else only if there is just one site
+		var defaultsite *engine.Object
+		sites := ao.Filter(func(o *engine.Object) bool {
+			return o.OneAttrString(engine.ObjectCategorySimple) == "Site"
+		}).Slice()
+		if len(sites) == 1 {
+			defaultsite = sites[0]
+		}
+		computersites := make(map[*engine.Object]*engine.Object)
+		for _, server := range ao.Filter(func(o *engine.Object) bool {
+			return o.HasAttr(activedirectory.ServerReference)
+		}).Slice() {
+			computer, found := ao.Find(engine.DistinguishedName, engine.AttributeValueString(server.OneAttrString(activedirectory.ServerReference)))
+			if !found {
+				continue
+			}
+			if servers, found := ao.DistinguishedParent(server); found {
+				if site, found := ao.DistinguishedParent(servers); found {
+					computersites[computer] = site
+				}
+			}
+		}
+
+		for _, gpo := range ao.Filter(func(o *engine.Object) bool {
+			return o.Type() == engine.ObjectTypeGroupPolicyContainer && o.HasAttr(activedirectory.GPCWQLFilter)
+		}).Slice() {
+			if filter := gpoWMIFilter(ao, gpo); filter != "" {
+				gpo.SetValues(activedirectory.MetaGPOWMIFilter, engine.AttributeValueString(filter))
+			}
+		}
+
+		var filtered int
+		unparsable := make(map[*engine.Object]struct{})
+		for _, o := range ao.Filter(func(o *engine.Object) bool {
+			return o.Type() == engine.ObjectTypeComputer || o.Type() == engine.ObjectTypeUser
+		}).Slice() {
+			site, found := computersites[o]
+			if !found {
+				site = defaultsite
+			}
+
+			disabledflag := int64(GPO_FLAG_USER_DISABLED)
+			if o.Type() == engine.ObjectTypeComputer {
+				disabledflag = GPO_FLAG_COMPUTER_DISABLED
+			}
+
+			var applied []engine.AttributeValue
+			var sids map[windowssecurity.SID]struct{}
+			for _, gpo := range appliedGPOs(ao, o, site) {
+				if flags, _ := gpo.AttrInt(activedirectory.Flags); flags&disabledflag != 0 {
+					continue
+				}
+				if sids == nil {
+					sids = gpoSecurityFilterSIDs(o)
+				}
+				allowed, err := gpoSecurityFilterAllows(gpo, sids)
+				if err != nil {
+					if _, logged := unparsable[gpo]; !logged {
+						log.Warn().Msgf("Could not parse security descriptor of GPO %v, assuming it applies to everyone: %v", gpo.DN(), err)
+						unparsable[gpo] = struct{}{}
+					}
+				}
+				if !allowed {
+					filtered++
+					continue
+				}
+				applied = append(applied, engine.AttributeValueObject{Object: gpo})
+				// Only for computers, you can't really pwn users this way
+				if o.Type() == engine.ObjectTypeComputer {
+					gpo.Pwns(o, activedirectory.PwnAffectedByGPO)
+				}
+			}
+			if len(applied) > 0 {
+				o.SetValues(activedirectory.MetaAppliedGPOs, applied...)
+			}
+		}
+		if filtered > 0 {
+			log.Debug().Msgf("Security filtering removed %v GPO applications", filtered)
+		}
+	}, "GPO applicability",
+		engine.AfterMerge,
+	)
+
+	Loader.AddProcessor(func(ao *engine.Objects) {
+		shares := shareIndex(ao)
+
+		for _, task := range ao.Filter(func(o *engine.Object) bool {
+			return o.Type() == engine.ObjectTypeScheduledTask && o.HasAttr(SourceGPOPath)
+		}).Slice() {
+			gpo, found := ao.Find(gPCFileSysPath, engine.AttributeValueString(task.OneAttrString(SourceGPOPath)))
+			if !found {
+				continue
+			}
+
+			affected := gpoAffectedComputers(gpo)
+
+			runas := task.OneAttrString(activedirectory.TaskRunAs)
+			switch {
+			case runas == "" || strings.Contains(runas, "%"):
+				// Runs as the logged on user
+			case activedirectory.IsLocalSystemAccount(runas):
+				for _, computer := range affected {
+					task.Pwns(computer, activedirectory.PwnRunsAs)
+				}
+			default:
+				var account *engine.Object
+				if sid, err := windowssecurity.SIDFromString(runas); err == nil {
+					if sid.Component(2) == 21 {
+						account, found = ao.Find(engine.ObjectSid, engine.AttributeValueSID(sid))
+					}
+				} else if strings.Contains(runas, "\\") {
+					account, found = ao.Find(engine.DownLevelLogonName, engine.AttributeValueString(runas))
+				} else {
+					account, found = ao.Find(engine.SAMAccountName, engine.AttributeValueString(runas))
+				}
+				if found && account.Type() != engine.ObjectTypeGroup {
+					task.Pwns(account, activedirectory.PwnRunsAs)
+				} else if !found {
+					log.Debug().Msgf("Could not resolve run as account %v for scheduled task %v in GPO %v", runas, task.Label(), gpo.Label())
+				}
+			}
+
+			// Principals that can write to the share hosting the executable can replace it
+			for executable, methods := range task.PwnableBy {
+				if !methods.IsSet(activedirectory.PwnScheduledTaskOnUNCPath) {
+					continue
+				}
+				share, found := shares[uncShare(executable.OneAttrString(AbsolutePath))]
+				if !found {
+					continue
+				}
+				for principal, sharemethods := range share.PwnableBy {
+					for _, method := range fileWriteMethods {
+						if sharemethods.IsSet(method) {
+							principal.Pwns(executable, method)
+						}
+					}
+				}
+			}
+		}
+	}, "GPO scheduled tasks",
+		engine.AfterMerge,
+	)
+
+	Loader.AddProcessor(func(ao *engine.Objects) {
+		shares := shareIndex(ao)
+
+		usersbygpo := gpoAffectedUsers(ao)
+		for _, script := range ao.Filter(func(o *engine.Object) bool {
+			return o.OneAttrString(engine.ObjectCategorySimple) == "Script" && o.HasAttr(ScriptFile)
+		}).Slice() {
+			gpo, found := ao.Find(gPCFileSysPath, engine.AttributeValueString(script.OneAttrString(SourceGPOPath)))
+			if !found {
+				continue
+			}
+			writers := scriptWriters(ao, script.OneAttrString(ScriptFile), shares)
+			if len(writers) == 0 {
+				continue
+			}
+
+			var targets []*engine.Object
+			if script.CanPwn[gpo].IsSet(activedirectory.PwnMachineScript) {
+				targets = gpoAffectedComputers(gpo)
+			} else {
+				targets = usersbygpo[gpo]
+			}
+
+			for writer := range writers {
+				for _, target := range targets {
+					writer.Pwns(target, activedirectory.PwnScriptWrite)
+				}
+			}
+		}
+
+		// Logon scripts from the scriptPath attribute are relative to NETLOGON on the DC the user logs on to,
+		// unless they point somewhere else
+		netlogons := netlogonShares(ao, shares)
+		for _, user := range ao.Filter(func(o *engine.Object) bool {
+			return o.Type() == engine.ObjectTypeUser && o.HasAttr(activedirectory.ScriptPath)
+		}).Slice() {
+			scriptpath := user.OneAttrString(activedirectory.ScriptPath)
+			var writers map[*engine.Object]struct{}
+			switch {
+			case strings.HasPrefix(scriptpath, "\\\\"):
+				writers = scriptWriters(ao, scriptpath, shares)
+			case strings.Contains(scriptpath, ":") || strings.Contains(scriptpath, "%"):
+				// Local path, different on every machine
+				continue
+			default:
+				writers = make(map[*engine.Object]struct{})
+				for _, share := range netlogons[user.OneAttrString(engine.DomainPart)] {
+					for principal := range shareWriters(share) {
+						writers[principal] = struct{}{}
+					}
+				}
+			}
+			for writer := range writers {
+				writer.Pwns(user, activedirectory.PwnScriptWrite)
+			}
+		}
+	}, "GPO and logon script writability",
+		engine.AfterMerge,
+	)
+
+	Loader.AddProcessor(func(ao *engine.Objects) {
+		shares := shareIndex(ao)
+		usersbygpo := gpoAffectedUsers(ao)
+
+		for _, gpo := range ao.Filter(func(o *engine.Object) bool {
+			return o.HasAttr(GPPSourcePathMachine) || o.HasAttr(GPPSourcePathUser)
+		}).Slice() {
+			// Machine preferences apply to computers, user preferences to the users
+			for _, scope := range []struct {
+				attribute engine.Attribute
+				targets   []*engine.Object
+			}{
+				{GPPSourcePathMachine, gpoAffectedComputers(gpo)},
+				{GPPSourcePathUser, usersbygpo[gpo]},
+			} {
+				for _, source := range gpo.AttrString(scope.attribute) {
+					for writer := range scriptWriters(ao, source, shares) {
+						for _, target := range scope.targets {
+							writer.Pwns(target, activedirectory.PwnGPPSourceWrite)
+						}
+					}
+				}
+			}
+		}
+	}, "GPO preference source writability",
+		engine.AfterMerge,
+	)
+
+	Loader.AddProcessor(func(ao *engine.Objects) {
+		assignees := make(map[string]*engine.Object)
+		resolve := func(assignee string) *engine.Object {
+			if o, found := assignees[assignee]; found {
+				return o
+			}
+			var o *engine.Object
+			if sid, err := windowssecurity.SIDFromString(assignee); err == nil {
+				o, _ = ao.Find(engine.ObjectSid, engine.AttributeValueSID(sid))
+			} else {
+				o, _ = ao.Find(engine.SAMAccountName, engine.AttributeValueString(assignee))
+			}
+			assignees[assignee] = o
+			return o
+		}
+
+		var rights int
+		for _, computer := range ao.Filter(func(o *engine.Object) bool {
+			return o.Type() == engine.ObjectTypeComputer && o.HasAttr(activedirectory.MetaAppliedGPOs)
+		}).Slice() {
+			// The GPO with the highest precedence defining a right replaces the assignments from all others
+			winners := make(map[string]*engine.Object)
+			for _, gpo := range appliedGPOList(computer) {
+				for _, assignment := range gpo.AttrString(UserRightsAssignments) {
+					privilege, _, _ := strings.Cut(assignment, " ")
+					winners[strings.ToLower(privilege)] = gpo
+				}
+			}
+			for privilege, gpo := range winners {
+				for _, assignment := range gpo.AttrString(UserRightsAssignments) {
+					assignedprivilege, assignee, _ := strings.Cut(assignment, " ")
+					if !strings.EqualFold(assignedprivilege, privilege) {
+						continue
+					}
+					if o := resolve(assignee); o != nil {
+						o.Pwns(computer, privilegePwns[privilege])
+						rights++
+					}
+				}
+			}
+		}
+		if rights > 0 {
+			log.Debug().Msgf("Added %v user rights assignment edges from GPOs to computers", rights)
+		}
+	}, "GPO user rights assignments",
+		engine.AfterMerge,
+	)
+
+	Loader.AddProcessor(func(ao *engine.Objects) {
+		var wdigest int
+		for _, computer := range ao.Filter(func(o *engine.Object) bool {
+			return o.Type() == engine.ObjectTypeComputer && o.HasAttr(activedirectory.MetaAppliedGPOs)
+		}).Slice() {
+			// Later GPOs in the applied list win
+			settings := make(map[engine.Attribute]int64)
+			var autologonuser string
+			for _, gpo := range appliedGPOList(computer) {
+				for _, attribute := range registryPolSecuritySettings {
+					if value, found := gpo.AttrInt(attribute); found {
+						settings[attribute] = value
+						if attribute == activedirectory.MetaGPOAutoAdminLogon {
+							autologonuser = gpo.OneAttrString(activedirectory.MetaGPOAutoAdminLogonUser)
+						}
+					}
+				}
+			}
+			for attribute, value := range settings {
+				computer.SetValues(attribute, engine.AttributeValueInt(value))
+			}
+			if settings[activedirectory.MetaGPOWDigest] == 1 {
+				wdigest++
+			}
+			if settings[activedirectory.MetaGPOAutoAdminLogon] == 1 && autologonuser != "" {
+				var user *engine.Object
+				if strings.Contains(autologonuser, "\\") {
+					user, _ = ao.Find(engine.DownLevelLogonName, engine.AttributeValueString(autologonuser))
+				} else if domainpart := computer.OneAttr(engine.DomainPart); domainpart != nil {
+					// Unqualified because the NetBIOS domain name of the GPO wasn't known, so look in the computers domain
+					if found, ok := ao.FindTwo(engine.SAMAccountName, engine.AttributeValueString(autologonuser), engine.DomainPart, domainpart); ok {
+						user = found
+					}
+				}
+				if user != nil {
+					computer.Pwns(user, activedirectory.PwnHasAutoAdminLogonCredentials)
+				}
+			}
+		}
+		if wdigest > 0 {
+			log.Warn().Msgf("GPOs enable WDigest cleartext credential caching on %v computers", wdigest)
+		}
+	}, "GPO registry policy settings",
+		engine.AfterMerge,
+	)
+
+	Loader.AddProcessor(func(ao *engine.Objects) {
+		// Unqualified usernames from GPOs where the NetBIOS domain name wasn't known, look in the domain of the GPO
+		for _, expobj := range ao.Filter(func(o *engine.Object) bool {
+			return o.HasAttr(ExposedUsername)
+		}).Slice() {
+			domainpart := expobj.OneAttr(engine.DomainPart)
+			if domainpart == nil {
+				continue
+			}
+			if user, found := ao.FindTwo(engine.SAMAccountName, expobj.OneAttr(ExposedUsername), engine.DomainPart, domainpart); found {
+				expobj.Pwns(user, PwnExposesPassword)
+			}
+		}
+	}, "Exposed passwords for unqualified usernames",
+		engine.AfterMerge,
+	)
+
+	Loader.AddProcessor(func(ao *engine.Objects) {
+		type passwordpolicy struct {
+			name       string
+			precedence int64
+			minlength  int64
+			maxage     int64 // days, 0 is never
+			lockout    int64
+			complexity bool
+		}
+		// Durations are stored as negative 100ns intervals
+		days := func(interval int64) int64 {
+			if interval >= 0 || interval == math.MinInt64 {
+				return 0
+			}
+			return -interval / (24 * 60 * 60 * 10000000)
+		}
+
+		// Default domain policies
+		domainpolicies := make(map[string]passwordpolicy)
+		for _, domain := range ao.Filter(func(o *engine.Object) bool {
+			return o.Type() == engine.ObjectTypeDomainDNS && o.HasAttr(activedirectory.MinPwdLength)
+		}).Slice() {
+			policy := passwordpolicy{
+				name: "Default Domain Policy",
+			}
+			policy.minlength, _ = domain.AttrInt(activedirectory.MinPwdLength)
+			maxage, _ := domain.AttrInt(activedirectory.MaxPwdAge)
+			policy.maxage = days(maxage)
+			policy.lockout, _ = domain.AttrInt(activedirectory.LockoutThreshold)
+			properties, _ := domain.AttrInt(activedirectory.PwdProperties)
+			policy.complexity = properties&0x01 /* DOMAIN_PASSWORD_COMPLEX */ != 0
+			domainpolicies[strings.ToLower(domain.DN())] = policy
+			log.Info().Msgf("Default password policy for %v: minimum length %v, maximum age %v days, lockout threshold %v, complexity %v", domain.DN(), policy.minlength, policy.maxage, policy.lockout, policy.complexity)
+		}
+
+		// Fine grained password policies, directly applied ones take priority over ones applied via groups
+		direct := make(map[*engine.Object]passwordpolicy)
+		viagroup := make(map[*engine.Object]passwordpolicy)
+		apply := func(m map[*engine.Object]passwordpolicy, o *engine.Object, policy passwordpolicy) {
+			if existing, found := m[o]; !found || policy.precedence < existing.precedence {
+				m[o] = policy
+			}
+		}
+		for _, pso := range ao.Filter(func(o *engine.Object) bool {
+			return o.HasAttr(activedirectory.MSDSPasswordPrecedence)
+		}).Slice() {
+			policy := passwordpolicy{
+				name: pso.OneAttrString(engine.Name),
+			}
+			policy.precedence, _ = pso.AttrInt(activedirectory.MSDSPasswordPrecedence)
+			policy.minlength, _ = pso.AttrInt(activedirectory.MSDSMinimumPasswordLength)
+			maxage, _ := pso.AttrInt(activedirectory.MSDSMaximumPasswordAge)
+			policy.maxage = days(maxage)
+			policy.lockout, _ = pso.AttrInt(activedirectory.MSDSLockoutThreshold)
+			policy.complexity = strings.EqualFold(pso.OneAttrString(activedirectory.MSDSPasswordComplexity), "true") || pso.OneAttrString(activedirectory.MSDSPasswordComplexity) == "1"
+
+			for _, appliesto := range pso.Attr(activedirectory.MSDSPSOAppliesTo).Slice() {
+				target, found := ao.Find(engine.DistinguishedName, engine.AttributeValueString(appliesto.String()))
+				if !found {
+					continue
+				}
+				if target.Type() == engine.ObjectTypeGroup {
+					for _, member := range target.Members(true) {
+						apply(viagroup, member, policy)
+					}
+				} else {
+					apply(direct, target, policy)
+				}
+			}
+		}
+
+		for _, user := range ao.Filter(func(o *engine.Object) bool {
+			return o.Type() == engine.ObjectTypeUser
+		}).Slice() {
+			policy, found := direct[user]
+			if !found {
+				policy, found = viagroup[user]
+			}
+			if !found {
+				policy, found = domainpolicies[strings.ToLower(user.OneAttrString(engine.DomainPart))]
+			}
+			if !found {
+				continue
+			}
+			complexity := 0
+			if policy.complexity {
+				complexity = 1
+			}
+			user.SetValues(activedirectory.MetaPasswordPolicy, engine.AttributeValueString(policy.name))
+			user.SetValues(activedirectory.MetaPasswordMinLength, engine.AttributeValueInt(policy.minlength))
+			user.SetValues(activedirectory.MetaPasswordMaxAge, engine.AttributeValueInt(policy.maxage))
+			user.SetValues(activedirectory.MetaLockoutThreshold, engine.AttributeValueInt(policy.lockout))
+			user.SetValues(activedirectory.MetaPasswordComplexity, engine.AttributeValueInt(complexity))
+		}
+	}, "effective password policies",
+		engine.AfterMerge,
+	)
+
+	Loader.AddProcessor(func(ao *engine.Objects) {
+		for _, trust := range ao.Filter(func(o *engine.Object) bool {
+			return o.Type() == engine.ObjectTypeTrust
+		}).Slice() {
+			ti := getTrustInfo(trust)
+			partnersid, ok := trust.OneAttrRaw(activedirectory.SecurityIdentifier).(windowssecurity.SID)
+			if !ok {
+				continue
+			}
+			partner, found := findDomain(ao, partnersid)
+			if !found {
+				continue
+			}
+			local, found := ao.Find(engine.DistinguishedName, engine.AttributeValueString(trust.OneAttrString(engine.DomainPart)))
+			if !found {
+				continue
+			}
+
+			var trusted, trusting *engine.Object
+			if ti.direction&activedirectory.TRUST_DIRECTION_OUTBOUND != 0 {
+				trusted, trusting = partner, local
+			} else if ti.direction&activedirectory.TRUST_DIRECTION_INBOUND != 0 {
+				if authoritative, found := findTrust(ao, partner.SID(), local.SID()); found && authoritative.object != trust {
+					continue
+				}
+				// Only the trusted side of this trust is loaded, so go with the mirrored attributes
+				trusted, trusting = local, partner
+			} else {
+				continue
+			}
+
+			// Without SID filtering the trusted domain can add privileged SIDs from the trusting domain to its tickets
+			if !ti.SIDFiltering() {
+				trusted.Pwns(trust, activedirectory.PwnCrossTrust)
+				trust.Pwns(trusting, activedirectory.PwnCrossTrust)
+			}
+		}
+	}, "Cross domain trust relationships",
+		engine.AfterMerge,
+	)
+
 	Loader.AddProcessor(func(ao *engine.Objects) {
 		var warnlines int
 		for _, gpo := range ao.Filter(func(o *engine.Object) bool {
@@ -0,0 +1,261 @@
+package analyze
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gofrs/uuid"
+	"github.com/lkarlslund/adalanche/modules/engine"
+	"github.com/lkarlslund/adalanche/modules/integrations/activedirectory"
+	"github.com/lkarlslund/adalanche/modules/windowssecurity"
+	"github.com/rs/zerolog/log"
+)
+
+// https://docs.microsoft.com/en-us/openspecs/windows_protocols/ms-gpol/08090b22-bc16-49f4-8e10-f27a8fb16d18
+const (
+	GPLINK_OPTION_DISABLED = 0x01
+	GPLINK_OPTION_ENFORCED = 0x02
+
+	GPOPTIONS_BLOCK_INHERITANCE = 0x01
+
+	GPO_FLAG_USER_DISABLED     = 0x01
+	GPO_FLAG_COMPUTER_DISABLED = 0x02
+)
+
+var ApplyGroupPolicy, _ = uuid.FromString("{edacfd8f-ffb3-11d1-b41d-00a0c968f939}")
+
+type gpoLink struct {
+	gpo     *engine.Object
+	options int64
+}
+
+// gpLinks returns the GPOs linked to a site, domain or OU in the order they are listed in gPLink. The last link
+// in the attribute has link order 1, so this is also the order in which they are applied.
+func gpLinks(ao *engine.Objects, som *engine.Object) []gpoLink {
+	gpcachelinks, found := som.Get(GPLinkCache)
+	if !found {
+		gpcachelinks = engine.NoValues{} // We assume there is nothing
+
+		gplinks := strings.Trim(som.OneAttrString(activedirectory.GPLink), " ")
+		if len(gplinks) != 0 {
+			if !strings.HasPrefix(gplinks, "[") || !strings.HasSuffix(gplinks, "]") {
+				log.Error().Msgf("Error parsing gplink on %v: %v", som.DN(), gplinks)
+			} else {
+				links := strings.Split(gplinks[1:len(gplinks)-1], "][")
+
+				var collecteddata engine.AttributeValueSlice
+				for _, link := range links {
+					linkinfo := strings.Split(link, ";")
+					if len(linkinfo) != 2 || len(linkinfo[0]) < 7 {
+						log.Error().Msgf("Error parsing gplink on %v: %v", som.DN(), gplinks)
+						continue
+					}
+					linkedgpodn := linkinfo[0][7:] // strip LDAP:// prefix and link to this
+
+					gpo, found := ao.Find(engine.DistinguishedName, engine.AttributeValueString(linkedgpodn))
+					if !found {
+						if _, warned := warnedgpos[linkedgpodn]; !warned {
+							warnedgpos[linkedgpodn] = struct{}{}
+							log.Warn().Msgf("Object linked to GPO that is not found %v: %v", som.DN(), linkedgpodn)
+						}
+					} else {
+						linktype, _ := strconv.ParseInt(linkinfo[1], 10, 64)
+						collecteddata = append(collecteddata, engine.AttributeValueObject{
+							Object: gpo,
+						}, engine.AttributeValueInt(linktype))
+					}
+				}
+				gpcachelinks = collecteddata
+			}
+		}
+		som.Set(GPLinkCache, gpcachelinks)
+	}
+
+	// cached or generated - pairwise pointer to gpo object and int
+	var results []gpoLink
+	gplinkslice := gpcachelinks.Slice()
+	for i := 0; i+1 < len(gplinkslice); i += 2 {
+		results = append(results, gpoLink{
+			gpo:     gplinkslice[i].Raw().(*engine.Object),
+			options: gplinkslice[i+1].Raw().(int64),
+		})
+	}
+	return results
+}
+
+// appliedGPOs returns the GPOs that apply to the object in the order they are processed, so later GPOs win.
+// https://docs.microsoft.com/en-us/openspecs/windows_protocols/ms-gpol/5c7ecdad-469f-4b30-94b3-450b7fff868f
+func appliedGPOs(ao *engine.Objects, o *engine.Object, site *engine.Object) []*engine.Object {
+	type somlinks struct {
+		links   []gpoLink
+		blocked bool
+	}
+
+	// Walk from the object towards the domain, remembering if anything below has blocked inheritance
+	var soms []somlinks
+	var blocking, hasparent bool
+	p := o
+	for {
+		newparent := p.Parent()
+		var foundparent bool
+		if newparent != nil && newparent.DN() != "" && strings.HasSuffix(p.DN(), newparent.DN()) {
+			p = newparent
+			foundparent = true
+		}
+		if !foundparent {
+			// Fall back to old slow method of looking at DNs
+			p, hasparent = ao.DistinguishedParent(p)
+			if !hasparent {
+				break
+			}
+		}
+
+		soms = append(soms, somlinks{
+			links:   gpLinks(ao, p),
+			blocked: blocking,
+		})
+
+		if gpoptions, _ := p.AttrInt(activedirectory.GPOptions); gpoptions&GPOPTIONS_BLOCK_INHERITANCE != 0 {
+			// inheritance is blocked, so let's not forget that when moving up
+			blocking = true
+		}
+	}
+	if site != nil {
+		soms = append(soms, somlinks{
+			links:   gpLinks(ao, site),
+			blocked: blocking,
+		})
+	}
+
+	var ordered []*engine.Object
+	// Non enforced links from site, domain and then OUs top down
+	for i := len(soms) - 1; i >= 0; i-- {
+		if soms[i].blocked {
+			continue
+		}
+		for _, link := range soms[i].links {
+			if link.options&(GPLINK_OPTION_DISABLED|GPLINK_OPTION_ENFORCED) == 0 {
+				ordered = append(ordered, link.gpo)
+			}
+		}
+	}
+	// Enforced links ignore blocking, and the ones closest to the top win
+	for _, som := range soms {
+		for _, link := range som.links {
+			if link.options&GPLINK_OPTION_DISABLED == 0 && link.options&GPLINK_OPTION_ENFORCED != 0 {
+				ordered = append(ordered, link.gpo)
+			}
+		}
+	}
+
+	// A GPO linked in several places is only applied once, at its highest precedence
+	seen := make(map[*engine.Object]struct{})
+	var results []*engine.Object
+	for i := len(ordered) - 1; i >= 0; i-- {
+		if _, found := seen[ordered[i]]; found {
+			continue
+		}
+		seen[ordered[i]] = struct{}{}
+		results = append(results, ordered[i])
+	}
+	for i, j := 0, len(results)-1; i < j; i, j = i+1, j-1 {
+		results[i], results[j] = results[j], results[i]
+	}
+	return results
+}
+
+// gpoSecurityFilterSIDs returns the SIDs of the object and its groups that security filtering is evaluated against
+func gpoSecurityFilterSIDs(o *engine.Object) map[windowssecurity.SID]struct{} {
+	sids := map[windowssecurity.SID]struct{}{
+		o.SID():                               {},
+		windowssecurity.EveryoneSID:           {},
+		windowssecurity.AuthenticatedUsersSID: {},
+	}
+	for _, sid := range o.MemberOfSID(true) {
+		sids[sid] = struct{}{}
+	}
+	if o.Type() == engine.ObjectTypeComputer {
+		if uac, ok := o.AttrInt(activedirectory.UserAccountControl); ok && uac&engine.UAC_SERVER_TRUST_ACCOUNT != 0 {
+			sids[EnterpriseDomainControllers] = struct{}{}
+		}
+	}
+	return sids
+}
+
+// gpoSecurityFilterAllows evaluates the "Apply Group Policy" extended right on the GPO for the SIDs from gpoSecurityFilterSIDs
+func gpoSecurityFilterAllows(gpo *engine.Object, sids map[windowssecurity.SID]struct{}) (bool, error) {
+	sd, err := gpo.SecurityDescriptor()
+	if err != nil {
+		// Can't tell, so assume the default of Authenticated Users
+		return true, err
+	}
+
+	var allowed bool
+	for _, ace := range sd.DACL.Entries {
+		if _, found := sids[ace.SID]; !found {
+			continue
+		}
+		if ace.ACEFlags&engine.ACEFLAG_INHERIT_ONLY_ACE != 0 || ace.Mask&engine.RIGHT_DS_CONTROL_ACCESS == 0 {
+			continue
+		}
+		switch ace.Type {
+		case engine.ACETYPE_ACCESS_ALLOWED_OBJECT, engine.ACETYPE_ACCESS_DENIED_OBJECT:
+			if ace.Flags&engine.OBJECT_TYPE_PRESENT != 0 && ace.ObjectType != ApplyGroupPolicy {
+				continue
+			}
+		case engine.ACETYPE_ACCESS_ALLOWED, engine.ACETYPE_ACCESS_DENIED:
+		default:
+			continue
+		}
+		if ace.Type == engine.ACETYPE_ACCESS_DENIED || ace.Type == engine.ACETYPE_ACCESS_DENIED_OBJECT {
+			return false, nil
+		}
+		allowed = true
+	}
+	return allowed, nil
+}
+
+// gpoWMIFilter returns the name of the WMI filter referenced by the GPO, if any
+func gpoWMIFilter(ao *engine.Objects, gpo *engine.Object) string {
+	// Format is [domain;{GUID};0]
+	parts := strings.Split(strings.Trim(gpo.OneAttrString(activedirectory.GPCWQLFilter), "[]"), ";")
+	if len(parts) < 2 {
+		return ""
+	}
+	if filters, found := ao.FindMulti(engine.Name, engine.AttributeValueString(parts[1])); found {
+		for _, filter := range filters {
+			if strings.Contains(strings.ToUpper(filter.DN()), ",CN=SOM,CN=WMIPOLICY,") {
+				if name := filter.OneAttrString(activedirectory.MSWMIName); name != "" {
+					return name
+				}
+			}
+		}
+	}
+	return parts[1]
+}
+
+// appliedGPOList returns the GPOs recorded by the applicability processor, in the order they are applied
+func appliedGPOList(o *engine.Object) []*engine.Object {
+	var results []*engine.Object
+	if applied, found := o.Get(activedirectory.MetaAppliedGPOs); found {
+		for _, value := range applied.Slice() {
+			if gpo, ok := value.Raw().(*engine.Object); ok {
+				results = append(results, gpo)
+			}
+		}
+	}
+	return results
+}
+
+// gpoAffectedUsers maps each GPO to the users it applies to, from the applicability processor
+func gpoAffectedUsers(ao *engine.Objects) map[*engine.Object][]*engine.Object {
+	results := make(map[*engine.Object][]*engine.Object)
+	for _, user := range ao.Filter(func(o *engine.Object) bool {
+		return o.Type() == engine.ObjectTypeUser && o.HasAttr(activedirectory.MetaAppliedGPOs)
+	}).Slice() {
+		for _, gpo := range appliedGPOList(user) {
+			results[gpo] = append(results[gpo], user)
+		}
+	}
+	return results
+}
@@ -0,0 +1,276 @@
+package analyze
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gofrs/uuid"
+	"github.com/lkarlslund/adalanche/modules/basedata"
+	"github.com/lkarlslund/adalanche/modules/engine"
+	"github.com/lkarlslund/adalanche/modules/integrations/activedirectory"
+	"github.com/lkarlslund/adalanche/modules/windowssecurity"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// Files in a GPMC backup folder
+const (
+	gpoBackupFile      = "Backup.xml"
+	gpoReportFile      = "gpreport.xml"
+	gpoBackupInfo      = "bkupInfo.xml"
+	gpoBackupSysvol    = "DomainSysvol"
+	gpoBackupSysvolGPO = "GPO"
+)
+
+// File system rights on SYSVOL that GPMC sets for the grouped GPO permissions
+const (
+	gpoFileRead        = 0x001200a9
+	gpoFileModify      = 0x001301bf
+	gpoFileFullControl = 0x001f01ff
+)
+
+// GPOBackup is the part of Backup.xml we need
+type GPOBackup struct {
+	ID     string `xml:"GroupPolicyObject>GroupPolicyCoreSettings>ID"`
+	Domain string `xml:"GroupPolicyObject>GroupPolicyCoreSettings>Domain"`
+}
+
+// GPOReport is the part of gpreport.xml we need
+type GPOReport struct {
+	Identifier string `xml:"Identifier>Identifier"`
+	Domain     string `xml:"Identifier>Domain"`
+	Owner      string `xml:"SecurityDescriptor>Owner>SID"`
+	Trustees   []struct {
+		SID        string `xml:"Trustee>SID"`
+		Type       string `xml:"Type>PermissionType"`
+		Inherited  bool   `xml:"Inherited"`
+		Standard   string `xml:"Standard>GPOGroupedAccessEnum"`
+		AccessMask uint32 `xml:"AccessMask"`
+	} `xml:"SecurityDescriptor>Permissions>TrusteePermissions"`
+}
+
+// isGPOBackupFile returns true for files that are part of a GPMC backup folder, so they're not reported as skipped
+func isGPOBackupFile(path string) bool {
+	dir := filepath.Dir(path)
+	switch strings.ToLower(filepath.Base(path)) {
+	case strings.ToLower(gpoReportFile), strings.ToLower(gpoBackupInfo):
+	default:
+		// Something in the DomainSysvol tree?
+		index := strings.Index(strings.ToLower(filepath.ToSlash(path)), "/"+strings.ToLower(gpoBackupSysvol)+"/")
+		if index == -1 {
+			return false
+		}
+		dir = filepath.FromSlash(filepath.ToSlash(path)[:index])
+	}
+	return findFold(dir, gpoBackupFile, false) != ""
+}
+
+// readGPOBackupXML unmarshals a backup XML file, which can be either UTF-8 or UTF-16 (gpreport.xml)
+func readGPOBackupXML(path string, v interface{}) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if bytes.HasPrefix(raw, []byte{0xff, 0xfe}) || bytes.HasPrefix(raw, []byte{0xfe, 0xff}) {
+		raw, err = unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM).NewDecoder().Bytes(raw)
+		if err != nil {
+			return err
+		}
+	}
+	decoder := xml.NewDecoder(bytes.NewReader(bytes.TrimPrefix(raw, []byte("\xef\xbb\xbf"))))
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		// Already converted to UTF-8 above
+		return input, nil
+	}
+	return decoder.Decode(v)
+}
+
+// GPOparseBackup maps a GPO backup folder exported by GPMC to the same structure we collect from SYSVOL
+func GPOparseBackup(backupdir string) (activedirectory.GPOdump, error) {
+	ginfo := activedirectory.GPOdump{
+		Common: basedata.GetCommonData(),
+	}
+
+	backupfile := findFold(backupdir, gpoBackupFile, false)
+	if backupfile == "" {
+		return ginfo, fmt.Errorf("no Backup.xml in %v", backupdir)
+	}
+	var backup GPOBackup
+	if err := readGPOBackupXML(backupfile, &backup); err != nil {
+		return ginfo, fmt.Errorf("problem reading %v: %v", backupfile, err)
+	}
+
+	var report GPOReport
+	var havereport bool
+	if reportfile := findFold(backupdir, gpoReportFile, false); reportfile != "" {
+		if err := readGPOBackupXML(reportfile, &report); err != nil {
+			log.Warn().Msgf("Problem reading %v, file permissions are not available: %v", reportfile, err)
+		} else {
+			havereport = true
+		}
+	}
+
+	guid := strings.TrimSpace(backup.ID)
+	if guid == "" {
+		guid = strings.TrimSpace(report.Identifier)
+	}
+	gpoguid, err := uuid.FromString(guid)
+	if err != nil {
+		return ginfo, fmt.Errorf("backup in %v has no valid GPO GUID (%v)", backupdir, guid)
+	}
+	domain := strings.TrimSpace(backup.Domain)
+	if domain == "" {
+		domain = strings.TrimSpace(report.Domain)
+	}
+	if domain == "" {
+		return ginfo, fmt.Errorf("backup in %v has no domain", backupdir)
+	}
+
+	ginfo.GUID = gpoguid
+	ginfo.DomainDN = "DC=" + strings.Join(strings.Split(domain, "."), ",DC=")
+	// The backup doesn't contain the NetBIOS domain name, and it can't be derived from the DNS name, so leave
+	// DomainNetbios blank and let the loader and merging sort it out
+
+	// The GPO object is matched on gPCFileSysPath, which is built from the GUID like this. The paths recorded
+	// in Backup.xml point to the DC the backup was taken from, so they can't be used.
+	ginfo.Path = fmt.Sprintf("\\\\%v\\SysVol\\%v\\Policies\\{%v}", domain, domain, strings.ToUpper(gpoguid.String()))
+
+	var owner windowssecurity.SID
+	var dacl []byte
+	if havereport {
+		owner, _ = windowssecurity.SIDFromString(strings.TrimSpace(report.Owner))
+		// This is an approximation: gpreport.xml only has the GPO permissions, so the same inheritable DACL
+		// derived from them is put on every file, and custom ACLs on individual SYSVOL files are not reflected
+		dacl = report.fileDACL()
+	}
+
+	sysvol := findFold(findFold(backupdir, gpoBackupSysvol, true), gpoBackupSysvolGPO, true)
+	if sysvol == "" {
+		log.Warn().Msgf("No %v folder in GPO backup %v", gpoBackupSysvol, backupdir)
+		return ginfo, nil
+	}
+	offset := len(sysvol)
+	err = filepath.WalkDir(sysvol, func(curpath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() &&
+			(strings.HasSuffix(strings.ToLower(curpath), ".adm") || strings.HasSuffix(strings.ToLower(curpath), ".admx")) {
+			// Skip .adm(x) files like the collector does
+			return nil
+		}
+
+		var fileinfo activedirectory.GPOfileinfo
+		fileinfo.IsDir = d.IsDir()
+		fileinfo.RelativePath = filepath.ToSlash(curpath[offset:])
+
+		// SYSVOL permissions are kept in sync with the GPO permissions and inherited by everything below
+		fileinfo.DACL = dacl
+		if fileinfo.RelativePath == "" {
+			fileinfo.OwnerSID = owner
+		}
+
+		if !d.IsDir() {
+			if info, err := d.Info(); err == nil {
+				fileinfo.Timestamp = info.ModTime()
+				fileinfo.Size = info.Size()
+			}
+			rawfile, err := os.ReadFile(curpath)
+			if err == nil {
+				fileinfo.Contents = rawfile
+			} else {
+				log.Warn().Msgf("Problem getting %v contents: %v", curpath, err)
+			}
+		}
+		ginfo.Files = append(ginfo.Files, fileinfo)
+		return nil
+	})
+	return ginfo, err
+}
+
+// fileDACL builds a binary DACL with the file system rights that the GPO permissions in the report translate to on SYSVOL
+func (report GPOReport) fileDACL() []byte {
+	var aces [][]byte
+	for _, trustee := range report.Trustees {
+		sid, err := windowssecurity.SIDFromString(strings.TrimSpace(trustee.SID))
+		if err != nil {
+			continue
+		}
+
+		var mask uint32
+		switch strings.TrimSpace(trustee.Standard) {
+		case "Edit, delete, modify security":
+			mask = gpoFileFullControl
+		case "Edit settings":
+			mask = gpoFileModify
+		case "Read", "Apply Group Policy":
+			mask = gpoFileRead
+		default:
+			// Custom permissions, translate the AD rights
+			mask = gpoFileRead
+			if trustee.AccessMask&uint32(engine.RIGHT_DS_WRITE_PROPERTY) != 0 {
+				mask |= gpoFileModify
+			}
+			mask |= trustee.AccessMask & uint32(engine.RIGHT_WRITE_DACL|engine.RIGHT_WRITE_OWNER)
+		}
+
+		acetype := byte(engine.ACETYPE_ACCESS_ALLOWED)
+		if strings.EqualFold(strings.TrimSpace(trustee.Type), "Deny") {
+			acetype = engine.ACETYPE_ACCESS_DENIED
+		}
+		aceflags := byte(0x01 | engine.ACEFLAG_INHERIT_ACE) // Object and container inherit
+		if trustee.Inherited {
+			aceflags |= engine.ACEFLAG_INHERITED_ACE
+		}
+
+		ace := make([]byte, 8, 8+len(sid))
+		ace[0] = acetype
+		ace[1] = aceflags
+		binary.LittleEndian.PutUint16(ace[2:], uint16(8+len(sid)))
+		binary.LittleEndian.PutUint32(ace[4:], mask)
+		aces = append(aces, append(ace, []byte(sid)...))
+	}
+	if len(aces) == 0 {
+		return nil
+	}
+
+	// Deny entries go first, like Windows would order them
+	acl := make([]byte, 8)
+	acl[0] = 2 // ACL_REVISION
+	var count int
+	for _, deny := range []bool{true, false} {
+		for _, ace := range aces {
+			if (ace[0] == engine.ACETYPE_ACCESS_DENIED) == deny {
+				acl = append(acl, ace...)
+				count++
+			}
+		}
+	}
+	binary.LittleEndian.PutUint16(acl[2:], uint16(len(acl)))
+	binary.LittleEndian.PutUint16(acl[4:], uint16(count))
+	return acl
+}
+
+// findFold finds a file or folder ignoring case, as backups copied from Windows can have any casing
+func findFold(dir, name string, isdir bool) string {
+	if dir == "" {
+		return ""
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	for _, entry := range entries {
+		if entry.IsDir() == isdir && strings.EqualFold(entry.Name(), name) {
+			return filepath.Join(dir, entry.Name())
+		}
+	}
+	return ""
+}
@@ -1,6 +1,7 @@
 package analyze
 
 import (
+	"bytes"
 	"encoding/xml"
 	"fmt"
 	"path/filepath"
@@ -22,6 +23,21 @@ var (
 	RelativePath    = engine.NewAttribute("relativePath").Single()
 	BinarySize      = engine.NewAttribute("binarySize").Single()
 	ExposedPassword = engine.NewAttribute("exposedPassword")
+	ExposedUsername = engine.NewAttribute("exposedUsername").Single()
+	ScriptFile      = engine.NewAttribute("scriptFile").Single()
+	SourceGPOPath   = engine.NewAttribute("sourceGPOPath").Single()
+
+	RegistryPolicyMachine = engine.NewAttribute("registryPolicyMachine")
+	RegistryPolicyUser    = engine.NewAttribute("registryPolicyUser")
+	UserRightsAssignments = engine.NewAttribute("userRightsAssignments")
+
+	GPPDrives               = engine.NewAttribute("gppDrives")
+	GPPPrinters             = engine.NewAttribute("gppPrinters")
+	GPPFiles                = engine.NewAttribute("gppFiles")
+	GPPRegistry             = engine.NewAttribute("gppRegistry")
+	GPPEnvironmentVariables = engine.NewAttribute("gppEnvironmentVariables")
+	GPPSourcePathMachine    = engine.NewAttribute("gppSourcePathMachine")
+	GPPSourcePathUser       = engine.NewAttribute("gppSourcePathUser")
 
 	PwnExposesPassword       = engine.NewPwn("ExposesPassword")
 	PwnContainsSensitiveData = engine.NewPwn("ContainsSensitiveData")
@@ -44,9 +60,6 @@ func init() {
 	})
 }
 
-var cpasswordusername = regexp.MustCompile(`(?i)cpassword="(?P<password>[^"]+)[^>]+(runAs|userName)="(?P<username>[^"]+)"`)
-var usernamecpassword = regexp.MustCompile(`(?i)(runAs|userName)="(?P<username>[^"]+)[^>]+cpassword="(?P<password>[^"]+)"`)
-
 func ImportGPOInfo(ginfo activedirectory.GPOdump, ao *engine.Objects) error {
 	if ginfo.DomainDN != "" {
 		ao.AddDefaultFlex(engine.DomainPart, ginfo.DomainDN)
@@ -126,37 +139,100 @@ func ImportGPOInfo(ginfo activedirectory.GPOdump, ao *engine.Objects) error {
 			}
 		}
 
-		var exposed []struct{ Username, Password string }
+		var exposed []exposedCredential
 
-		for _, line := range strings.Split(string(item.Contents), "\n") {
-			var unhandledpass bool
+		if strings.HasSuffix(relativepath, ".xml") && bytes.Contains(item.Contents, []byte("cpassword=")) {
+			passwords, err := GPOparseCPasswords(item.Contents)
+			if err != nil {
+				log.Warn().Msgf("Problem parsing passwords in %v from GPO %v: %v", item.RelativePath, ginfo.Path, err)
+				itemobject.SetValues(activedirectory.MetaUnparsedCPassword, engine.AttributeValueInt(1))
+			}
+			for _, gp := range passwords {
+				log.Debug().Msgf("Found %v password for %v in %s", gp.Kind, gp.Username, item.RelativePath)
+				password := gp.Password
+				if password == "" {
+					password = gp.CPassword
+				}
+				username := gp.Username
+				var domainaccount bool
+				if username != "" && !strings.Contains(username, "\\") && gp.Kind != "User" {
+					// Services, tasks, drives etc. run with domain accounts unless qualified otherwise
+					if ginfo.DomainNetbios != "" {
+						username = ginfo.DomainNetbios + "\\" + username
+					} else {
+						domainaccount = true
+					}
+				}
+				exposed = append(exposed, exposedCredential{username, password, domainaccount})
+			}
+		}
 
-			// FIXME: Handle other formats, adding something to catch this here
-			if strings.Contains(line, "cpassword=") && !strings.Contains(line, "cpassword=\"\"") {
-				log.Debug().Msgf("Found cpassword in %s", item.RelativePath)
-				log.Debug().Msgf("GPO Dump\n%s", item.Contents)
-				unhandledpass = true
+		if relativepath == "/machine/registry.pol" || relativepath == "/user/registry.pol" {
+			entries, err := activedirectory.ParseRegistryPol(item.Contents)
+			if err != nil {
+				log.Warn().Msgf("Problem parsing %v from GPO %v: %v", item.RelativePath, ginfo.Path, err)
 			}
-			for _, match := range cpasswordusername.FindAllStringSubmatch(line, -1) {
-				log.Debug().Msgf("Found password in %s", item.RelativePath)
-				log.Debug().Msgf("Password: %v", match)
-				log.Debug().Msgf("GPO Dump\n%s", item.Contents)
-				exposed = append(exposed, struct{ Username, Password string }{match[cpasswordusername.SubexpIndex("username")], match[cpasswordusername.SubexpIndex("password")]})
-				unhandledpass = false
+
+			machine := strings.HasPrefix(relativepath, "/machine/")
+			var settings []engine.AttributeValue
+			var autologonuser, autologondomain, autologonpassword string
+			for _, entry := range entries {
+				settings = append(settings, engine.AttributeValueString(entry.Key+"\\"+entry.ValueName+" = "+entry.String()))
+				if !machine || entry.IsDeletion() {
+					continue
+				}
+				setting := strings.ToLower(entry.Key + "\\" + entry.ValueName)
+				if attribute, found := registryPolSecuritySettings[setting]; found {
+					if value, ok := entry.Int(); ok {
+						if setting == windowsLAPSBackupDirectory {
+							// 0 is disabled, 1 is Azure AD and 2 is AD - only the latter puts the password where we can see who reads it
+							if value == 2 {
+								value = 1
+							} else {
+								value = 0
+							}
+						}
+						gpoobject.SetValues(attribute, engine.AttributeValueInt(value))
+					}
+				}
+				switch setting {
+				case winlogonKey + "\\defaultusername":
+					autologonuser = entry.String()
+				case winlogonKey + "\\defaultdomainname":
+					autologondomain = entry.String()
+				case winlogonKey + "\\defaultpassword":
+					autologonpassword = entry.String()
+				}
 			}
-			for _, match := range usernamecpassword.FindAllStringSubmatch(line, -1) {
-				log.Debug().Msgf("Found username in %s", item.RelativePath)
-				log.Debug().Msgf("Password: %v", match)
-				log.Debug().Msgf("GPO Dump\n%s", item.Contents)
-				exposed = append(exposed, struct{ Username, Password string }{match[usernamecpassword.SubexpIndex("username")], match[usernamecpassword.SubexpIndex("password")]})
-				unhandledpass = false
+
+			if len(settings) > 0 {
+				if machine {
+					gpoobject.SetValues(RegistryPolicyMachine, settings...)
+				} else {
+					gpoobject.SetValues(RegistryPolicyUser, settings...)
+				}
 			}
-			if unhandledpass {
-				log.Error().Msgf("Unhandled password in %s", item.RelativePath)
-				log.Error().Msgf("GPO Dump\n%s", item.Contents)
-				log.Panic().Msg("Please submit bugreport on Github with redacted account name and redacted password")
+
+			if autologonuser != "" {
+				if autologondomain == "" {
+					autologondomain = ginfo.DomainNetbios
+				}
+				var domainaccount bool
+				if !strings.Contains(autologonuser, "\\") {
+					if autologondomain != "" {
+						autologonuser = autologondomain + "\\" + autologonuser
+					} else {
+						domainaccount = true
+					}
+				}
+				gpoobject.SetValues(activedirectory.MetaGPOAutoAdminLogonUser, engine.AttributeValueString(autologonuser))
+				if autologonpassword != "" {
+					// Cleartext in SYSVOL, readable like any GPP password
+					exposed = append(exposed, exposedCredential{autologonuser, autologonpassword, domainaccount})
+				}
 			}
 		}
+
 		for _, e := range exposed {
 			// New object to contain the sensitive data
 			expobj := ao.AddNew(
@@ -165,15 +241,20 @@ func ImportGPOInfo(ginfo activedirectory.GPOdump, ao *engine.Objects) error {
 				ExposedPassword, e.Password,
 			)
 
-			// The account targeted
-			target, _ := ao.FindOrAdd(
-				engine.DownLevelLogonName, engine.AttributeValueString(e.Username),
-			)
-
 			// GPO exposes this object
 			itemobject.Pwns(expobj, PwnContainsSensitiveData)
-			// Exposed password leaks this object
-			expobj.Pwns(target, PwnExposesPassword)
+
+			// The account targeted, local accounts differ on every computer so we can't point at those
+			if strings.Contains(e.Username, "\\") && !strings.HasPrefix(e.Username, ".\\") && !strings.Contains(e.Username, "%") {
+				target, _ := ao.FindOrAdd(
+					engine.DownLevelLogonName, engine.AttributeValueString(e.Username),
+				)
+				// Exposed password leaks this object
+				expobj.Pwns(target, PwnExposesPassword)
+			} else if e.DomainAccount && !strings.Contains(e.Username, "%") {
+				// Resolved against the accounts in the GPOs domain once everything is merged
+				expobj.SetValues(ExposedUsername, engine.AttributeValueString(e.Username))
+			}
 
 			// Everyone that can read the file can then read the password
 			if item.DACL != nil {
@@ -193,6 +274,29 @@ func ImportGPOInfo(ginfo activedirectory.GPOdump, ao *engine.Objects) error {
 			}
 
 		}
+
+		// User rights assignments are kept on the GPO as "<privilege> <SID or name>", and linked to the
+		// affected computers after merging where precedence between GPOs is known
+		if relativepath == "/machine/microsoft/windows nt/secedit/gpttmpl.inf" {
+			var assignments []engine.AttributeValue
+			for _, assignment := range GPOparsePrivilegeRights(string(item.Contents)) {
+				if _, found := privilegePwns[strings.ToLower(assignment.Privilege)]; !found {
+					continue
+				}
+				if assignment.SID.IsNull() {
+					ao.FindOrAdd(engine.SAMAccountName, engine.AttributeValueString(assignment.Name))
+					assignments = append(assignments, engine.AttributeValueString(assignment.Privilege+" "+assignment.Name))
+				} else if assignment.SID.Component(2) == 21 || assignment.SID == windowssecurity.EveryoneSID || assignment.SID == windowssecurity.AuthenticatedUsersSID {
+					ao.FindOrAddSID(assignment.SID)
+					assignments = append(assignments, engine.AttributeValueString(assignment.Privilege+" "+assignment.SID.String()))
+				}
+				// Local groups and service identities are different objects on every machine
+			}
+			if len(assignments) > 0 {
+				gpoobject.SetValues(UserRightsAssignments, assignments...)
+			}
+		}
+
 		switch relativepath {
 		case "/machine/preferences/groups/groups.xml", "/machine/microsoft/windows nt/secedit/gpttmpl.inf":
 			var pairs []SIDpair
@@ -231,13 +335,75 @@ func ImportGPOInfo(ginfo activedirectory.GPOdump, ao *engine.Objects) error {
 				}
 			}
 
-			// Description: "Indicates that a GPO deploys a scheduled task which is running from an UNC path (FIXME, not done yet!)",
+		// Description: "Scheduled tasks deployed by GPO, and the UNC paths they execute from",
 		case "/machine/preferences/scheduledtasks/scheduledtasks.xml":
-			for _, task := range GPOparseScheduledTasks(string(item.Contents)) {
-				log.Warn().Msgf("Scheduled task: %v ... FIXME!", task)
+			tasks, err := GPOparseScheduledTasks(string(item.Contents))
+			if err != nil {
+				log.Warn().Msgf("Problem parsing scheduled tasks from GPO %v: %v", ginfo.Path, err)
 			}
-		// Description: "Detects startup or shutdown scripts from GPOs",
-		case "/machine/scripts/scripts.ini":
+			for i, task := range tasks {
+				var commandlines []string
+				for _, exec := range task.Exec {
+					commandlines = append(commandlines, strings.Trim(exec.Command+" "+exec.Arguments, " "))
+				}
+
+				// Create new synthetic object
+				tob := engine.NewObject(
+					engine.IgnoreBlanks,
+					engine.ObjectCategorySimple, engine.AttributeValueString("ScheduledTask"),
+					engine.DistinguishedName, engine.AttributeValueString(fmt.Sprintf("CN=Scheduled Task %v from GPO %v,CN=synthetic", i, ginfo.GUID)),
+					engine.Name, engine.AttributeValueString(task.Name),
+					engine.DisplayName, engine.AttributeValueString(task.Kind+" "+task.Name),
+					activedirectory.TaskRunAs, task.RunAs,
+					activedirectory.TaskLogonType, task.LogonType,
+					activedirectory.TaskRunLevel, task.RunLevel,
+					activedirectory.TaskCommandLine, strings.Join(commandlines, "\n"),
+					SourceGPOPath, ginfo.Path,
+				)
+				ao.Add(tob)
+				tob.ChildOf(gpoobject)
+
+				for _, uncpath := range task.UNCPaths() {
+					executable, _ := ao.FindOrAdd(AbsolutePath, engine.AttributeValueString(uncpath),
+						engine.DisplayName, engine.AttributeValueString(uncpath),
+						engine.ObjectCategorySimple, engine.AttributeValueString("Executable"),
+					)
+					executable.Pwns(tob, activedirectory.PwnScheduledTaskOnUNCPath)
+				}
+			}
+		// Description: "Group Policy Preferences settings, and the UNC paths they copy or run from",
+		case "/machine/preferences/drives/drives.xml", "/user/preferences/drives/drives.xml",
+			"/machine/preferences/printers/printers.xml", "/user/preferences/printers/printers.xml",
+			"/machine/preferences/files/files.xml", "/user/preferences/files/files.xml",
+			"/machine/preferences/registry/registry.xml", "/user/preferences/registry/registry.xml",
+			"/machine/preferences/environmentvariables/environmentvariables.xml", "/user/preferences/environmentvariables/environmentvariables.xml":
+			items, err := GPOparsePreferenceItems(item.Contents)
+			if err != nil {
+				log.Warn().Msgf("Problem parsing %v from GPO %v: %v", item.RelativePath, ginfo.Path, err)
+			}
+
+			scope, sourceattribute := "Machine", GPPSourcePathMachine
+			if strings.HasPrefix(relativepath, "/user/") {
+				scope, sourceattribute = "User", GPPSourcePathUser
+			}
+			var settings, sources []engine.AttributeValue
+			for _, pi := range items {
+				settings = append(settings, engine.AttributeValueString(scope+": "+pi.String()))
+				for _, source := range pi.SourcePaths() {
+					sources = append(sources, engine.AttributeValueString(source))
+				}
+			}
+
+			// Machine and user settings share the attribute
+			attribute := gppSettingAttributes[filepath.Base(relativepath)]
+			if len(settings) > 0 {
+				gpoobject.SetValues(attribute, append(gpoobject.Attr(attribute).Slice(), settings...)...)
+			}
+			if len(sources) > 0 {
+				gpoobject.SetValues(sourceattribute, append(gpoobject.Attr(sourceattribute).Slice(), sources...)...)
+			}
+		// Description: "Detects startup, shutdown, logon and logoff scripts from GPOs",
+		case "/machine/scripts/scripts.ini", "/machine/scripts/psscripts.ini", "/user/scripts/scripts.ini", "/user/scripts/psscripts.ini":
 			scripts := string(item.Contents)
 			utf8 := make([]byte, len(scripts)/2)
 			_, _, err := unicode.UTF16(unicode.LittleEndian, unicode.UseBOM).NewDecoder().Transform(utf8, []byte(scripts), true)
@@ -252,45 +418,42 @@ func ImportGPOInfo(ginfo activedirectory.GPOdump, ao *engine.Objects) error {
 			}, utf8)
 
 			if err != nil {
-				log.Warn().Msgf("Problem loading GPO ini file SCRIPTS.INI from %v: %v", ginfo.Path, err)
+				log.Warn().Msgf("Problem loading GPO ini file %v from %v: %v", strings.ToUpper(filepath.Base(relativepath)), ginfo.Path, err)
+				continue
 			}
 
-			scriptnum := 0
-			for {
-				k1 := inifile.Section("Startup").Key(fmt.Sprintf("%vCmdLine", scriptnum))
-				k2 := inifile.Section("Startup").Key(fmt.Sprintf("%vParameters", scriptnum))
-				if k1.String() == "" {
-					break
-				}
-				// Create new synthetic object
-				sob := engine.NewObject(
-					engine.ObjectCategorySimple, engine.AttributeValueString("Script"),
-					engine.DistinguishedName, engine.AttributeValueString(fmt.Sprintf("CN=Startup Script %v from GPO %v,CN=synthetic", scriptnum, ginfo.GUID)),
-					engine.Name, engine.AttributeValueString("Machine startup script "+strings.Trim(k1.String()+" "+k2.String(), " ")),
-				)
-				ao.Add(sob)
-				sob.Pwns(gpoobject, activedirectory.PwnMachineScript)
-				sob.ChildOf(gpoobject) // tree
-				scriptnum++
-			}
-
-			scriptnum = 0
-			for {
-				k1 := inifile.Section("Shutdown").Key(fmt.Sprintf("%vCmdLine", scriptnum))
-				k2 := inifile.Section("Shutdown").Key(fmt.Sprintf("%vParameters", scriptnum))
-				if k1.String() == "" {
-					break
+			machine := strings.HasPrefix(relativepath, "/machine/")
+			scope, sections := "Machine", []string{"Startup", "Shutdown"}
+			if !machine {
+				scope, sections = "User", []string{"Logon", "Logoff"}
+			}
+			kind := "Script"
+			if strings.HasSuffix(relativepath, "psscripts.ini") {
+				kind = "PowerShell Script"
+			}
+
+			for _, section := range sections {
+				for scriptnum := 0; ; scriptnum++ {
+					k1 := inifile.Section(section).Key(fmt.Sprintf("%vCmdLine", scriptnum))
+					k2 := inifile.Section(section).Key(fmt.Sprintf("%vParameters", scriptnum))
+					if k1.String() == "" {
+						break
+					}
+					// Create new synthetic object
+					sob := engine.NewObject(
+						engine.IgnoreBlanks,
+						engine.ObjectCategorySimple, engine.AttributeValueString("Script"),
+						engine.DistinguishedName, engine.AttributeValueString(fmt.Sprintf("CN=%v %v %v from GPO %v,CN=synthetic", section, kind, scriptnum, ginfo.GUID)),
+						engine.Name, engine.AttributeValueString(scope+" "+strings.ToLower(section)+" "+strings.ToLower(kind)+" "+strings.Trim(k1.String()+" "+k2.String(), " ")),
+						ScriptFile, gpoScriptPath(ginfo.Path, filepath.Dir(relativepath), section, k1.String()),
+						SourceGPOPath, ginfo.Path,
+					)
+					ao.Add(sob)
+					if machine {
+						sob.Pwns(gpoobject, activedirectory.PwnMachineScript)
+					}
+					sob.ChildOf(gpoobject) // tree
 				}
-				// Create new synthetic object
-				sob := engine.NewObject(
-					engine.DistinguishedName, engine.AttributeValueString(fmt.Sprintf("CN=Shutdown Script %v from GPO %v,CN=synthetic", scriptnum, ginfo.GUID)),
-					engine.ObjectCategorySimple, engine.AttributeValueString("Script"),
-					engine.Name, engine.AttributeValueString("Machine shutdown script "+strings.Trim(k1.String()+" "+k2.String(), " ")),
-				)
-				ao.Add(sob)
-				sob.Pwns(gpoobject, activedirectory.PwnMachineScript)
-				sob.ChildOf(gpoobject)
-				scriptnum++
 			}
 		}
 	}
@@ -299,44 +462,102 @@ func ImportGPOInfo(ginfo activedirectory.GPOdump, ao *engine.Objects) error {
 }
 
 type ScheduledTasks struct {
-	Tasks []TaskV2 `xml:"TaskV2"`
+	Tasks []ScheduledTask `xml:",any"`
 }
 
-type TaskV2 struct {
-	UserID   string   `xml:"Properties>Task>Principals>Principal>UserId"`
-	RunLevel string   `xml:"Properties>Task>Principals>Principal>RunLevel"`
-	Actions  []Action `xml:"Properties>Task>Actions"`
+// ScheduledTask covers the Task, ImmediateTask, TaskV2 and ImmediateTaskV2 preference items
+type ScheduledTask struct {
+	XMLName    xml.Name
+	Name       string                  `xml:"name,attr"`
+	Properties ScheduledTaskProperties `xml:"Properties"`
 }
 
-type Action struct {
-	Command   string `xml:"Exec>Command"`
-	Arguments string `xml:"Exec>Arguments"`
+type ScheduledTaskProperties struct {
+	Action    string `xml:"action,attr"`
+	Name      string `xml:"name,attr"`
+	AppName   string `xml:"appName,attr"` // Task and ImmediateTask
+	Args      string `xml:"args,attr"`
+	RunAs     string `xml:"runAs,attr"`
+	LogonType string `xml:"logonType,attr"`
+
+	// TaskV2 and ImmediateTaskV2 embed a task scheduler definition
+	UserID             string     `xml:"Task>Principals>Principal>UserId"`
+	GroupID            string     `xml:"Task>Principals>Principal>GroupId"`
+	RunLevel           string     `xml:"Task>Principals>Principal>RunLevel"`
+	PrincipalLogonType string     `xml:"Task>Principals>Principal>LogonType"`
+	Exec               []TaskExec `xml:"Task>Actions>Exec"`
+}
+
+type TaskExec struct {
+	Command   string `xml:"Command"`
+	Arguments string `xml:"Arguments"`
+}
+
+type GPOScheduledTask struct {
+	Kind      string
+	Name      string
+	RunAs     string
+	LogonType string
+	RunLevel  string
+	Exec      []TaskExec
+}
+
+// UNCPaths returns executables and scripts referenced via UNC paths in the commands or arguments
+func (st GPOScheduledTask) UNCPaths() []string {
+	var results []string
+	for _, exec := range st.Exec {
+		results = append(results, uncexec.FindAllString(exec.Command+" "+exec.Arguments, -1)...)
+	}
+	return results
 }
 
 var (
-	uncexec       = regexp.MustCompile(`\\\\.*\\.*\\.*\.(cmd|bat|ps1|vbs|exe|dll)`)
+	uncexec       = regexp.MustCompile(`(?i)\\\\[^\\\s"]+\\[^\s"]*?\.(cmd|bat|ps1|vbs|js|exe|dll|msi)`)
 	importantsids = regexp.MustCompile(`S-1-5-32-(544|555|562)`)
 )
 
-func GPOparseScheduledTasks(rawxml string) []string {
-	var results []string
+func GPOparseScheduledTasks(rawxml string) ([]GPOScheduledTask, error) {
+	var results []GPOScheduledTask
 	var tasks ScheduledTasks
 	err := xml.Unmarshal([]byte(rawxml), &tasks)
-	if err == nil {
-		for _, task := range tasks.Tasks {
-			if task.RunLevel == "HighestAvailable" {
-				for _, action := range task.Actions {
-					cmd := action.Command + " " + action.Arguments
-
-					// Check if we're running remote stuff
-					if remoteexec := uncexec.FindAllString(cmd, -1); remoteexec != nil {
-						results = append(results, remoteexec...)
-					}
-				}
+	if err != nil {
+		return nil, err
+	}
+	for _, task := range tasks.Tasks {
+		props := task.Properties
+		if props.Action == "D" {
+			// Deletes the task, nothing runs
+			continue
+		}
+		result := GPOScheduledTask{
+			Kind:      task.XMLName.Local,
+			Name:      task.Name,
+			RunAs:     props.RunAs,
+			LogonType: props.LogonType,
+			RunLevel:  props.RunLevel,
+		}
+		if result.Name == "" {
+			result.Name = props.Name
+		}
+		switch task.XMLName.Local {
+		case "Task", "ImmediateTask":
+			result.Exec = []TaskExec{{Command: props.AppName, Arguments: props.Args}}
+		case "TaskV2", "ImmediateTaskV2":
+			if props.UserID != "" {
+				result.RunAs = props.UserID
+			} else if props.GroupID != "" {
+				result.RunAs = props.GroupID
+			}
+			if props.PrincipalLogonType != "" {
+				result.LogonType = props.PrincipalLogonType
 			}
+			result.Exec = props.Exec
+		default:
+			continue
 		}
+		results = append(results, result)
 	}
-	return results
+	return results, nil
 }
 
 type Groups struct {
@@ -400,6 +621,99 @@ func GPOparseGroups(rawxml string) []SIDpair {
 	return results
 }
 
+// Attributes on the GPO object for the Group Policy Preferences files, keyed by lowercase file name
+var gppSettingAttributes = map[string]engine.Attribute{
+	"drives.xml":               GPPDrives,
+	"printers.xml":             GPPPrinters,
+	"files.xml":                GPPFiles,
+	"registry.xml":             GPPRegistry,
+	"environmentvariables.xml": GPPEnvironmentVariables,
+}
+
+const winlogonKey = `software\microsoft\windows nt\currentversion\winlogon`
+
+// Windows LAPS backup target, normalised to the 0/1 of legacy LAPS AdmPwdEnabled
+const windowsLAPSBackupDirectory = `software\microsoft\policies\laps\backupdirectory`
+
+// Security relevant machine settings from Registry.pol, keyed by lowercase key\valuename
+var registryPolSecuritySettings = map[string]engine.Attribute{
+	`system\currentcontrolset\control\lsa\runasppl`:                                 activedirectory.MetaGPOLSAProtection,
+	`system\currentcontrolset\control\securityproviders\wdigest\uselogoncredential`: activedirectory.MetaGPOWDigest,
+	`software\policies\microsoft services\admpwd\admpwdenabled`:                     activedirectory.MetaGPOLAPSEnabled,
+	windowsLAPSBackupDirectory:                                                      activedirectory.MetaGPOLAPSEnabled,
+	`system\currentcontrolset\services\ntds\parameters\ldapserverintegrity`:         activedirectory.MetaGPOLDAPServerIntegrity,
+	`system\currentcontrolset\services\ldap\ldapclientintegrity`:                    activedirectory.MetaGPOLDAPClientIntegrity,
+	`system\currentcontrolset\control\lsa\lmcompatibilitylevel`:                     activedirectory.MetaGPOLMCompatibilityLevel,
+	`system\currentcontrolset\control\lsa\msv1_0\restrictsendingntlmtraffic`:        activedirectory.MetaGPORestrictSendingNTLM,
+	`system\currentcontrolset\control\lsa\msv1_0\restrictreceivingntlmtraffic`:      activedirectory.MetaGPORestrictReceivingNTLM,
+	winlogonKey + `\autoadminlogon`:                                                 activedirectory.MetaGPOAutoAdminLogon,
+}
+
+// Privileges to exploits - from https://github.com/gtworek/Priv2Admin
+var privilegePwns = map[string]engine.PwnMethod{
+	"sebackupprivilege":             activedirectory.PwnSeBackupPrivilege,
+	"serestoreprivilege":            activedirectory.PwnSeRestorePrivilege,
+	"seassignprimarytokenprivilege": activedirectory.PwnSeAssignPrimaryToken,
+	"secreatetokenprivilege":        activedirectory.PwnSeCreateToken,
+	"sedebugprivilege":              activedirectory.PwnSeDebug,
+	"seimpersonateprivilege":        activedirectory.PwnSeImpersonate,
+	"seloaddriverprivilege":         activedirectory.PwnSeLoadDriver,
+	"semanagevolumeprivilege":       activedirectory.PwnSeManageVolume,
+	"setakeownershipprivilege":      activedirectory.PwnSeTakeOwnership,
+	"setcbprivilege":                activedirectory.PwnSeTcb,
+	"seremoteinteractivelogonright": activedirectory.PwnLocalRDPRights,
+}
+
+type PrivilegeAssignment struct {
+	Privilege string
+	SID       windowssecurity.SID
+	Name      string
+}
+
+// GPOparsePrivilegeRights returns the assignments from the [Privilege Rights] section of GptTmpl.inf
+func GPOparsePrivilegeRights(rawini string) []PrivilegeAssignment {
+	var results []PrivilegeAssignment
+
+	utf8 := make([]byte, len(rawini)/2)
+	_, _, err := unicode.UTF16(unicode.LittleEndian, unicode.UseBOM).NewDecoder().Transform(utf8, []byte(rawini), true)
+	if err != nil {
+		utf8 = []byte(rawini)
+	}
+
+	gpt, err := ini.LoadSources(ini.LoadOptions{
+		SkipUnrecognizableLines: true,
+	}, utf8)
+	if err != nil {
+		return nil
+	}
+	for _, key := range gpt.Section("Privilege Rights").Keys() {
+		for _, assignee := range strings.Split(key.String(), ",") {
+			assignee = strings.Trim(assignee, " ")
+			if assignee == "" {
+				continue
+			}
+			pa := PrivilegeAssignment{
+				Privilege: key.Name(),
+			}
+			if strings.HasPrefix(assignee, "*") {
+				sid, err := windowssecurity.SIDFromString(assignee[1:])
+				if err != nil {
+					log.Warn().Msgf("GPO GptTmplInf privilege %v has invalid SID %v: %v", key.Name(), assignee, err)
+					continue
+				}
+				pa.SID = sid
+			} else if translatedsid, err := TranslateLocalizedGroupToSID(assignee); err == nil {
+				pa.SID = translatedsid
+			} else {
+				// Plain account names are used when the SID could not be resolved by the editor
+				pa.Name = assignee
+			}
+			results = append(results, pa)
+		}
+	}
+	return results
+}
+
 func GPOparseGptTmplInf(rawini string) []SIDpair {
 	var results []SIDpair
 
@@ -511,3 +825,120 @@ func GPOparseGptTmplInf(rawini string) []SIDpair {
 	}
 	return results
 }
+
+// uncShare reduces an UNC path to the "\\server\share" form used for share display names, stripping any DNS suffix from the server
+func uncShare(path string) string {
+	parts := strings.SplitN(strings.TrimPrefix(path, "\\\\"), "\\", 3)
+	if len(parts) < 2 {
+		return ""
+	}
+	server, _, _ := strings.Cut(parts[0], ".")
+	return strings.ToLower("\\\\" + server + "\\" + parts[1])
+}
+
+// gpoAffectedComputers returns the computers a GPO applies to
+func gpoAffectedComputers(gpo *engine.Object) []*engine.Object {
+	var affected []*engine.Object
+	for o, methods := range gpo.CanPwn {
+		if methods.IsSet(activedirectory.PwnAffectedByGPO) && o.Type() == engine.ObjectTypeComputer {
+			affected = append(affected, o)
+		}
+	}
+	return affected
+}
+
+// gpoScriptPath resolves a script command line from scripts.ini to the absolute path used for the GPO file objects,
+// or the UNC path if it's located elsewhere. Local paths are different on every machine, so they return blank.
+func gpoScriptPath(gpopath, inidir, section, cmdline string) string {
+	cmdline = strings.Trim(cmdline, "\" ")
+	switch {
+	case strings.HasPrefix(strings.ToLower(cmdline), strings.ToLower(gpopath)+"\\"):
+		// UNC path pointing into this GPO
+		relativepath := strings.ToLower(strings.ReplaceAll(cmdline[len(gpopath):], "\\", "/"))
+		return filepath.Join(gpopath, relativepath)
+	case strings.HasPrefix(cmdline, "\\\\"):
+		return cmdline
+	case strings.Contains(cmdline, ":") || strings.Contains(cmdline, "%"):
+		return ""
+	}
+	// Relative to the scripts folder for the section
+	return filepath.Join(gpopath, inidir, strings.ToLower(section), strings.ToLower(strings.ReplaceAll(cmdline, "\\", "/")))
+}
+
+// Methods on a file that let a principal replace its contents
+var fileWriteMethods = []engine.PwnMethod{PwnFileWrite, PwnModifyDACL, PwnTakeOwnership}
+
+// Methods on a collected GPO file that let a principal replace its contents, the owner can always change the DACL
+var gpoFileWriteMethods = []engine.PwnMethod{PwnFileWrite, PwnModifyDACL, PwnTakeOwnership, PwnOwns}
+
+// shareIndex maps \\server\share in lowercase to the share objects from localmachine data
+func shareIndex(ao *engine.Objects) map[string]*engine.Object {
+	shares := make(map[string]*engine.Object)
+	for _, share := range ao.Filter(func(o *engine.Object) bool {
+		return o.OneAttrString(engine.ObjectCategorySimple) == "Share"
+	}).Slice() {
+		shares[strings.ToLower(share.OneAttrString(engine.DisplayName))] = share
+	}
+	return shares
+}
+
+// shareWriters returns the principals with write access to a share
+func shareWriters(share *engine.Object) map[*engine.Object]struct{} {
+	writers := make(map[*engine.Object]struct{})
+	for principal, methods := range share.PwnableBy {
+		for _, method := range fileWriteMethods {
+			if methods.IsSet(method) {
+				writers[principal] = struct{}{}
+			}
+		}
+	}
+	return writers
+}
+
+// netlogonShares maps each domain (DomainPart) to the NETLOGON shares on its domain controllers
+func netlogonShares(ao *engine.Objects, shares map[string]*engine.Object) map[string][]*engine.Object {
+	results := make(map[string][]*engine.Object)
+	for _, dc := range ao.Filter(func(o *engine.Object) bool {
+		uac, ok := o.AttrInt(activedirectory.UserAccountControl)
+		return o.Type() == engine.ObjectTypeComputer && ok && uac&engine.UAC_SERVER_TRUST_ACCOUNT != 0
+	}).Slice() {
+		server := strings.TrimSuffix(dc.OneAttrString(engine.SAMAccountName), "$")
+		if server == "" {
+			server, _, _ = strings.Cut(dc.OneAttrString(activedirectory.DNSHostName), ".")
+		}
+		if share, found := shares[strings.ToLower("\\\\"+server+"\\netlogon")]; found {
+			domain := dc.OneAttrString(engine.DomainPart)
+			results[domain] = append(results[domain], share)
+		}
+	}
+	return results
+}
+
+// scriptWriters returns the principals that can change the script at the path, either from the collected GPO files
+// or from the share it's located on
+func scriptWriters(ao *engine.Objects, path string, shares map[string]*engine.Object) map[*engine.Object]struct{} {
+	writers := make(map[*engine.Object]struct{})
+	if file, found := ao.Find(AbsolutePath, engine.AttributeValueString(path)); found {
+		for principal, methods := range file.PwnableBy {
+			for _, method := range gpoFileWriteMethods {
+				if methods.IsSet(method) {
+					writers[principal] = struct{}{}
+				}
+			}
+		}
+		// Taking over a parent folder gives control of everything inside it
+		for folder := file.Parent(); folder != nil && folder.HasAttr(AbsolutePath); folder = folder.Parent() {
+			for principal, methods := range folder.PwnableBy {
+				if methods.IsSet(PwnModifyDACL) || methods.IsSet(PwnTakeOwnership) || methods.IsSet(PwnOwns) {
+					writers[principal] = struct{}{}
+				}
+			}
+		}
+	}
+	if share, found := shares[uncShare(path)]; found {
+		for principal := range shareWriters(share) {
+			writers[principal] = struct{}{}
+		}
+	}
+	return writers
+}
@@ -0,0 +1,49 @@
+package analyze
+
+import (
+	"testing"
+
+	"github.com/lkarlslund/adalanche/modules/engine"
+	"github.com/lkarlslund/adalanche/modules/integrations/activedirectory"
+)
+
+func TestNetlogonShares(t *testing.T) {
+	ao := engine.NewObjects()
+
+	dc := engine.NewObject(
+		activedirectory.DistinguishedName, "CN=DC01,OU=Domain Controllers,DC=corp,DC=local",
+		engine.ObjectCategorySimple, "Computer",
+		engine.SAMAccountName, "DC01$",
+		engine.DomainPart, "DC=corp,DC=local",
+		activedirectory.UserAccountControl, int64(engine.UAC_SERVER_TRUST_ACCOUNT),
+	)
+	member := engine.NewObject(
+		activedirectory.DistinguishedName, "CN=SRV01,CN=Computers,DC=corp,DC=local",
+		engine.ObjectCategorySimple, "Computer",
+		engine.SAMAccountName, "SRV01$",
+		engine.DomainPart, "DC=corp,DC=local",
+		activedirectory.UserAccountControl, int64(engine.UAC_WORKSTATION_TRUST_ACCOUNT),
+	)
+	// Share names as the local machine importer creates them
+	netlogon := engine.NewObject(
+		activedirectory.DistinguishedName, "CN=netlogon,CN=Shares,CN=DC01",
+		engine.ObjectCategorySimple, "Share",
+		engine.DisplayName, `\\DC01\NETLOGON`,
+	)
+	membershare := engine.NewObject(
+		activedirectory.DistinguishedName, "CN=netlogon,CN=Shares,CN=SRV01",
+		engine.ObjectCategorySimple, "Share",
+		engine.DisplayName, `\\SRV01\NETLOGON`,
+	)
+	ao.Add(dc, member, netlogon, membershare)
+
+	shares := shareIndex(ao)
+	if shares[`\\dc01\netlogon`] != netlogon {
+		t.Fatalf("share index has keys %v, want \\\\dc01\\netlogon", shares)
+	}
+
+	results := netlogonShares(ao, shares)
+	if len(results) != 1 || len(results["DC=corp,DC=local"]) != 1 || results["DC=corp,DC=local"][0] != netlogon {
+		t.Errorf("got %v, want only the DC NETLOGON share for DC=corp,DC=local", results)
+	}
+}
@@ -39,20 +39,33 @@ func (ld *GPOLoader) Init() error {
 		ld.done.Add(1)
 		go func() {
 			for path := range ld.gpofiletoprocess {
-				raw, err := ioutil.ReadFile(path)
-				if err != nil {
-					log.Warn().Msgf("Problem reading data from GPO JSON file %v: %v", path, err)
-					continue
-				}
-
 				var ginfo activedirectory.GPOdump
-				err = json.Unmarshal(raw, &ginfo)
-				if err != nil {
-					log.Warn().Msgf("Problem unmarshalling data from JSON file %v: %v", path, err)
-					continue
-				}
+				var thisao *engine.Objects
+				if strings.EqualFold(filepath.Base(path), gpoBackupFile) {
+					// GPMC backup folder, all backups next to each other end up in the same shard
+					backupdir := filepath.Dir(path)
+					var err error
+					ginfo, err = GPOparseBackup(backupdir)
+					if err != nil {
+						log.Warn().Msgf("Problem reading GPO backup %v: %v", backupdir, err)
+						continue
+					}
+					thisao = ld.getShard(backupdir)
+				} else {
+					raw, err := ioutil.ReadFile(path)
+					if err != nil {
+						log.Warn().Msgf("Problem reading data from GPO JSON file %v: %v", path, err)
+						continue
+					}
 
-				thisao := ld.getShard(path)
+					err = json.Unmarshal(raw, &ginfo)
+					if err != nil {
+						log.Warn().Msgf("Problem unmarshalling data from JSON file %v: %v", path, err)
+						continue
+					}
+
+					thisao = ld.getShard(path)
+				}
 
 				netbios := ginfo.DomainNetbios
 				if netbios == "" {
@@ -80,7 +93,7 @@ func (ld *GPOLoader) Init() error {
 					}
 				}
 
-				err = ImportGPOInfo(ginfo, thisao)
+				err := ImportGPOInfo(ginfo, thisao)
 				if err != nil {
 					log.Warn().Msgf("Problem importing GPO: %v", err)
 					continue
@@ -115,6 +128,14 @@ func (ld *GPOLoader) Load(path string, cb engine.ProgressCallbackFunc) error {
 		ld.gpofiletoprocess <- path
 		return nil
 	}
+	if strings.EqualFold(filepath.Base(path), gpoBackupFile) {
+		ld.gpofiletoprocess <- path
+		return nil
+	}
+	if isGPOBackupFile(path) {
+		// Read along with Backup.xml
+		return nil
+	}
 	return engine.ErrUninterested
 }
 
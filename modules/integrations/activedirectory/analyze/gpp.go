@@ -0,0 +1,143 @@
+package analyze
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+	"unicode/utf16"
+)
+
+// AES key for Group Policy Preferences passwords, published by Microsoft in MS-GPPREF 2.2.1.1.4
+var gppKey = []byte{
+	0x4e, 0x99, 0x06, 0xe8, 0xfc, 0xb6, 0x6c, 0xc9, 0xfa, 0xf4, 0x93, 0x10, 0x62, 0x0f, 0xfe, 0xe8,
+	0xf4, 0x96, 0xe8, 0x06, 0xcc, 0x05, 0x79, 0x90, 0x20, 0x9b, 0x09, 0xa4, 0x33, 0xb6, 0x6c, 0x1b,
+}
+
+// Attributes holding the account for the password, depending on the preference type
+var gppUsernameAttributes = []string{"userName", "username", "accountName", "runAs", "newName"}
+
+// GPPPassword is a cpassword found in a Group Policy Preferences item
+type GPPPassword struct {
+	Kind      string // Element name, User, NTService, Task, DataSource, Drive, SharedPrinter etc.
+	Name      string
+	Username  string
+	CPassword string
+	Password  string // Decrypted, blank if decryption failed
+}
+
+type exposedCredential struct {
+	Username string
+	Password string
+	// Unqualified domain account, because the NetBIOS domain name of the GPO wasn't known
+	DomainAccount bool
+}
+
+// GPOparseCPasswords finds all items with a cpassword in any Group Policy Preferences XML file
+// (Groups, Services, ScheduledTasks, DataSources, Drives and Printers)
+func GPOparseCPasswords(rawxml []byte) ([]GPPPassword, error) {
+	var results []GPPPassword
+	var decrypterr error
+
+	decoder := xml.NewDecoder(bytes.NewReader(bytes.TrimPrefix(rawxml, []byte("\xef\xbb\xbf"))))
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		// GPP files are UTF-8 regardless of what the header claims
+		return input, nil
+	}
+
+	// Names of the enclosing items, as Properties has the details but the item element has the name
+	var items []xml.StartElement
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return results, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			items = append(items, t)
+			cpassword := xmlAttr(t, "cpassword")
+			if cpassword == "" {
+				continue
+			}
+			gp := GPPPassword{
+				CPassword: cpassword,
+			}
+			for _, attr := range gppUsernameAttributes {
+				if gp.Username = xmlAttr(t, attr); gp.Username != "" {
+					break
+				}
+			}
+			if t.Name.Local == "Properties" && len(items) > 1 {
+				parent := items[len(items)-2]
+				gp.Kind = parent.Name.Local
+				gp.Name = xmlAttr(parent, "name")
+			} else {
+				gp.Kind = t.Name.Local
+				gp.Name = xmlAttr(t, "name")
+			}
+			if gp.Password, err = DecryptCPassword(cpassword); err != nil {
+				// Keep it, the encrypted value is still a finding
+				decrypterr = err
+			}
+			results = append(results, gp)
+		case xml.EndElement:
+			if len(items) > 0 {
+				items = items[:len(items)-1]
+			}
+		}
+	}
+	return results, decrypterr
+}
+
+func xmlAttr(element xml.StartElement, name string) string {
+	for _, attr := range element.Attr {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// DecryptCPassword decrypts a Group Policy Preferences cpassword with the published key
+func DecryptCPassword(cpassword string) (string, error) {
+	// Base64 without padding
+	if padding := len(cpassword) % 4; padding != 0 {
+		cpassword += strings.Repeat("=", 4-padding)
+	}
+	data, err := base64.StdEncoding.DecodeString(cpassword)
+	if err != nil {
+		return "", err
+	}
+	if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return "", errors.New("cpassword is not a multiple of the AES block size")
+	}
+
+	block, err := aes.NewCipher(gppKey)
+	if err != nil {
+		return "", err
+	}
+	plaintext := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, make([]byte, aes.BlockSize)).CryptBlocks(plaintext, data)
+
+	// PKCS#7 padding
+	padding := int(plaintext[len(plaintext)-1])
+	if padding == 0 || padding > aes.BlockSize || padding > len(plaintext) {
+		return "", errors.New("cpassword has invalid padding")
+	}
+	plaintext = plaintext[:len(plaintext)-padding]
+
+	// UTF-16 password
+	chars := make([]uint16, len(plaintext)/2)
+	for i := range chars {
+		chars[i] = binary.LittleEndian.Uint16(plaintext[i*2:])
+	}
+	return string(utf16.Decode(chars)), nil
+}
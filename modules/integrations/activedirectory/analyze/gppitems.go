@@ -0,0 +1,145 @@
+package analyze
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// GPPItem is a single Group Policy Preferences item with the attributes from its Properties element
+type GPPItem struct {
+	Kind       string // Element name, Drive, SharedPrinter, PortPrinter, LocalPrinter, File, Registry or EnvironmentVariable
+	Name       string
+	Properties map[string]string
+}
+
+var (
+	uncpath    = regexp.MustCompile(`\\\\[^\\\s";,]+\\[^\s";,]*`)
+	runkey     = regexp.MustCompile(`(?i)\\currentversion\\(run|runonce|runservices|runservicesonce)$`)
+	gppActions = map[string]string{"C": "Create", "R": "Replace", "U": "Update", "D": "Delete"}
+)
+
+// GPOparsePreferenceItems returns all items from a Group Policy Preferences XML file, including the ones nested
+// in collections (Registry.xml)
+func GPOparsePreferenceItems(rawxml []byte) ([]GPPItem, error) {
+	var results []GPPItem
+
+	decoder := xml.NewDecoder(bytes.NewReader(bytes.TrimPrefix(rawxml, []byte("\xef\xbb\xbf"))))
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		// GPP files are UTF-8 regardless of what the header claims
+		return input, nil
+	}
+
+	var items []xml.StartElement
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return results, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			items = append(items, t)
+			if t.Name.Local != "Properties" || len(items) < 2 {
+				continue
+			}
+			parent := items[len(items)-2]
+			gi := GPPItem{
+				Kind:       parent.Name.Local,
+				Name:       xmlAttr(parent, "name"),
+				Properties: make(map[string]string),
+			}
+			for _, attr := range t.Attr {
+				gi.Properties[attr.Name.Local] = attr.Value
+			}
+			results = append(results, gi)
+		case xml.EndElement:
+			if len(items) > 0 {
+				items = items[:len(items)-1]
+			}
+		}
+	}
+	return results, nil
+}
+
+// IsDeletion returns true if the item removes the setting
+func (gi GPPItem) IsDeletion() bool {
+	return gi.Properties["action"] == "D"
+}
+
+// String renders the setting in a readable form
+func (gi GPPItem) String() string {
+	p := gi.Properties
+	action := gppActions[p["action"]]
+	if action == "" {
+		action = "Update"
+	}
+
+	var setting string
+	switch gi.Kind {
+	case "Drive":
+		letter := p["letter"]
+		if letter != "" {
+			letter += ": "
+		}
+		setting = letter + p["path"]
+	case "SharedPrinter":
+		setting = p["path"]
+	case "PortPrinter":
+		setting = strings.Trim(p["localName"]+" "+p["ipAddress"], " ")
+	case "LocalPrinter":
+		setting = p["name"]
+	case "File":
+		setting = p["fromPath"] + " -> " + p["targetPath"]
+	case "Registry":
+		setting = fmt.Sprintf("%v\\%v\\%v = %v", p["hive"], p["key"], p["name"], p["value"])
+	case "EnvironmentVariable":
+		scope := "System"
+		if p["user"] == "1" {
+			scope = "User"
+		}
+		setting = fmt.Sprintf("%v %v = %v", scope, p["name"], p["value"])
+	default:
+		setting = gi.Name
+	}
+	return gi.Kind + " " + action + " " + setting
+}
+
+// SourcePaths returns the UNC paths the item takes content from or makes computers execute from, so anyone
+// who can write there controls what ends up on the computer
+func (gi GPPItem) SourcePaths() []string {
+	if gi.IsDeletion() {
+		return nil
+	}
+	p := gi.Properties
+	switch gi.Kind {
+	case "File":
+		if strings.HasPrefix(p["fromPath"], "\\\\") {
+			return []string{p["fromPath"]}
+		}
+	case "Registry":
+		if runkey.MatchString(p["key"]) {
+			return uncexec.FindAllString(p["value"], -1)
+		}
+	case "EnvironmentVariable":
+		// Only search paths make programs load code from the share, other variables are just data
+		if _, found := searchPathVariables[strings.ToLower(p["name"])]; found {
+			return uncpath.FindAllString(p["value"], -1)
+		}
+	}
+	return nil
+}
+
+// Environment variables that programs search for executables, modules or libraries to load
+var searchPathVariables = map[string]struct{}{
+	"path":         {},
+	"psmodulepath": {},
+	"pythonpath":   {},
+	"perl5lib":     {},
+	"classpath":    {},
+}
@@ -0,0 +1,144 @@
+package analyze
+
+import (
+	"strings"
+
+	"github.com/lkarlslund/adalanche/modules/engine"
+	"github.com/lkarlslund/adalanche/modules/integrations/activedirectory"
+	"github.com/lkarlslund/adalanche/modules/windowssecurity"
+)
+
+type trustinfo struct {
+	object     *engine.Object
+	direction  int64
+	trusttype  int64
+	attributes int64
+}
+
+func getTrustInfo(o *engine.Object) trustinfo {
+	ti := trustinfo{
+		object: o,
+	}
+	ti.direction, _ = o.AttrInt(activedirectory.TrustDirection)
+	ti.trusttype, _ = o.AttrInt(activedirectory.TrustType)
+	ti.attributes, _ = o.AttrInt(activedirectory.TrustAttributes)
+	return ti
+}
+
+func (ti trustinfo) Direction() string {
+	switch ti.direction {
+	case 0:
+		return "disabled"
+	case activedirectory.TRUST_DIRECTION_INBOUND:
+		return "incoming"
+	case activedirectory.TRUST_DIRECTION_OUTBOUND:
+		return "outgoing"
+	case activedirectory.TRUST_DIRECTION_INBOUND | activedirectory.TRUST_DIRECTION_OUTBOUND:
+		return "bidirectional"
+	}
+	return "unknown"
+}
+
+func (ti trustinfo) Kind() string {
+	switch {
+	case ti.trusttype == activedirectory.TRUST_TYPE_MIT:
+		return "MIT Kerberos realm"
+	case ti.attributes&activedirectory.TRUST_ATTRIBUTE_WITHIN_FOREST != 0:
+		return "intra-forest"
+	case ti.attributes&activedirectory.TRUST_ATTRIBUTE_FOREST_TRANSITIVE != 0:
+		return "forest"
+	}
+	return "external"
+}
+
+// Transitive returns true if the trust can be chained with other trusts
+func (ti trustinfo) Transitive() bool {
+	if ti.attributes&activedirectory.TRUST_ATTRIBUTE_NON_TRANSITIVE != 0 {
+		return false
+	}
+	return ti.attributes&(activedirectory.TRUST_ATTRIBUTE_WITHIN_FOREST|activedirectory.TRUST_ATTRIBUTE_FOREST_TRANSITIVE) != 0
+}
+
+// SelectiveAuthentication returns true if users from the trusted domain need Allowed-To-Authenticate on resources
+func (ti trustinfo) SelectiveAuthentication() bool {
+	return ti.attributes&activedirectory.TRUST_ATTRIBUTE_CROSS_ORGANIZATION != 0
+}
+
+// TGTDelegation returns true if TGTs for users in the trusting domain are delegated to unconstrained delegation hosts in the trusted domain
+func (ti trustinfo) TGTDelegation() bool {
+	if ti.attributes&activedirectory.TRUST_ATTRIBUTE_WITHIN_FOREST != 0 {
+		return true
+	}
+	if ti.attributes&activedirectory.TRUST_ATTRIBUTE_CROSS_ORGANIZATION_NO_TGT_DELEGATE != 0 {
+		return false
+	}
+	// Disabled by default on cross forest trusts since the July 2019 update
+	return ti.attributes&activedirectory.TRUST_ATTRIBUTE_CROSS_ORGANIZATION_ENABLE_TGT_DELE != 0
+}
+
+// SIDFiltering returns true if the trusting side removes SIDs from its own domain from tickets coming from the trusted domain
+func (ti trustinfo) SIDFiltering() bool {
+	switch {
+	case ti.trusttype == activedirectory.TRUST_TYPE_MIT:
+		return true
+	case ti.attributes&activedirectory.TRUST_ATTRIBUTE_QUARANTINED_DOMAIN != 0:
+		return true
+	case ti.attributes&activedirectory.TRUST_ATTRIBUTE_WITHIN_FOREST != 0:
+		return false
+	case ti.attributes&activedirectory.TRUST_ATTRIBUTE_FOREST_TRANSITIVE != 0:
+		// SID history enabled on forest trust still filters RIDs below 1000
+		return ti.attributes&activedirectory.TRUST_ATTRIBUTE_TREAT_AS_EXTERNAL == 0
+	}
+	// External trust without quarantine
+	return false
+}
+
+// SIDFilterAllows returns true if the sid from the trusting domain would survive in a ticket coming across the trust
+func (ti trustinfo) SIDFilterAllows(sid windowssecurity.SID) bool {
+	if ti.SIDFiltering() {
+		return false
+	}
+	if ti.attributes&activedirectory.TRUST_ATTRIBUTE_FOREST_TRANSITIVE != 0 && sid.RID() < 1000 {
+		return false
+	}
+	return true
+}
+
+// findDomain returns the domainDNS object with the given SID
+func findDomain(ao *engine.Objects, domainsid windowssecurity.SID) (*engine.Object, bool) {
+	if domains, found := ao.FindMulti(engine.ObjectSid, engine.AttributeValueSID(domainsid)); found {
+		for _, domain := range domains {
+			if domain.Type() == engine.ObjectTypeDomainDNS {
+				return domain, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// findTrust locates the trust where the trusting domain trusts the trusted domain. The trusting side is authoritative
+// for SID filtering, so we prefer that, and fall back to the trusted side's view if we only have that domain loaded
+func findTrust(ao *engine.Objects, trusting, trusted windowssecurity.SID) (trustinfo, bool) {
+	lookup := func(domainsid, partnersid windowssecurity.SID, direction int64) (trustinfo, bool) {
+		domain, found := findDomain(ao, domainsid)
+		if !found {
+			return trustinfo{}, false
+		}
+		if trusts, found := ao.FindMulti(activedirectory.SecurityIdentifier, engine.AttributeValueSID(partnersid)); found {
+			for _, trust := range trusts {
+				if trust.Type() != engine.ObjectTypeTrust || !strings.EqualFold(trust.OneAttrString(engine.DomainPart), domain.DN()) {
+					continue
+				}
+				if ti := getTrustInfo(trust); ti.direction&direction != 0 {
+					return ti, true
+				}
+			}
+		}
+		return trustinfo{}, false
+	}
+
+	if ti, found := lookup(trusting, trusted, activedirectory.TRUST_DIRECTION_OUTBOUND); found {
+		return ti, true
+	}
+	return lookup(trusted, trusting, activedirectory.TRUST_DIRECTION_INBOUND)
+}
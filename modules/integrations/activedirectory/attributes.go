@@ -5,7 +5,13 @@ import (
 )
 
 var (
-	PwnForeignIdentity = engine.NewPwn("ForeignIdentity")
+	PwnForeignIdentity = engine.NewPwn("ForeignIdentity").RegisterProbabilityCalculator(func(source, target *engine.Object) engine.Probability {
+		if target.HasAttr(MetaTrustSelectiveAuthentication) {
+			// Trust requires Allowed-To-Authenticate on the resource, so only some systems can be reached
+			return 50
+		}
+		return 100
+	})
 
 	DistinguishedName          = engine.NewAttribute("distinguishedName").Tag("AD").Unique().Single()
 	ObjectClass                = engine.NewAttribute("objectClass").Tag("AD")
@@ -75,7 +81,8 @@ var (
 	MSmcsAdmPwdExpirationTime   = engine.NewAttribute("ms-mcs-AdmPwdExpirationTime").Tag("AD").Type(engine.AttributeTypeTime) // LAPS password timeout
 	SecurityIdentifier          = engine.NewAttribute("securityIdentifier").Type(engine.AttributeTypeSID)
 	TrustDirection              = engine.NewAttribute("trustDirection").Type(engine.AttributeTypeInt)
-	TrustAttributes             = engine.NewAttribute("trustAttributes")
+	TrustAttributes             = engine.NewAttribute("trustAttributes").Type(engine.AttributeTypeInt)
+	TrustType                   = engine.NewAttribute("trustType").Type(engine.AttributeTypeInt)
 	TrustPartner                = engine.NewAttribute("trustPartner")
 	DsHeuristics                = engine.NewAttribute("dsHeuristics").Tag("AD")
 	AttributeSecurityGUID       = engine.NewAttribute("attributeSecurityGUID").Tag("AD")
@@ -83,7 +90,83 @@ var (
 	RightsGUID                  = engine.NewAttribute("rightsGUID").Tag("AD").Type(engine.AttributeTypeGUID)
 	GPLink                      = engine.NewAttribute("gPLink").Tag("AD")
 	GPOptions                   = engine.NewAttribute("gPOptions").Tag("AD")
+	GPCWQLFilter                = engine.NewAttribute("gPCWQLFilter").Tag("AD")
+	Flags                       = engine.NewAttribute("flags").Tag("AD")
+	MSWMIName                   = engine.NewAttribute("msWMI-Name").Tag("AD")
+	ServerReference             = engine.NewAttribute("serverReference").Tag("AD")
 	ScriptPath                  = engine.NewAttribute("scriptPath").Tag("AD").Single()
 	MSPKICertificateNameFlag    = engine.NewAttribute("msPKI-Certificate-Name-Flag").Tag("AD").Type(engine.AttributeTypeInt)
 	PKIExtendedUsage            = engine.NewAttribute("pKIExtendedKeyUsage").Tag("AD")
+	MSLAPSPwdExpirationTime     = engine.NewAttribute("msLAPS-PasswordExpirationTime").Tag("AD").Type(engine.AttributeTypeTime) // Windows LAPS password timeout
+	MSLAPSEncryptedPassword     = engine.NewAttribute("msLAPS-EncryptedPassword").Tag("AD")
+	MSLAPSEncryptedDSRMPwd      = engine.NewAttribute("msLAPS-EncryptedDSRMPassword").Tag("AD")
+	MSDSMachineAccountQuota     = engine.NewAttribute("ms-DS-MachineAccountQuota").Tag("AD").Type(engine.AttributeTypeInt)
+	DNSHostName                 = engine.NewAttribute("dNSHostName").Tag("AD")
+	MSDSKeyCredentialLink       = engine.NewAttribute("msDS-KeyCredentialLink").Tag("AD")
+	MSDSDeviceID                = engine.NewAttribute("msDS-DeviceID").Tag("AD").Type(engine.AttributeTypeGUID)
+	ManagedBy                   = engine.NewAttribute("managedBy").Tag("AD")
+	MSDSRevealOnDemandGroup     = engine.NewAttribute("msDS-RevealOnDemandGroup").Tag("AD")
+	MSDSNeverRevealGroup        = engine.NewAttribute("msDS-NeverRevealGroup").Tag("AD")
+	MSDSRevealedList            = engine.NewAttribute("msDS-RevealedList").Tag("AD")
+	MaxPwdAge                   = engine.NewAttribute("maxPwdAge").Tag("AD").Type(engine.AttributeTypeInt)
+	LockoutThreshold            = engine.NewAttribute("lockoutThreshold").Tag("AD").Type(engine.AttributeTypeInt)
+	MSDSPSOAppliesTo            = engine.NewAttribute("msDS-PSOAppliesTo").Tag("AD")
+	MSDSPasswordPrecedence      = engine.NewAttribute("msDS-PasswordSettingsPrecedence").Tag("AD").Type(engine.AttributeTypeInt)
+	MSDSMinimumPasswordLength   = engine.NewAttribute("msDS-MinimumPasswordLength").Tag("AD").Type(engine.AttributeTypeInt)
+	MSDSMaximumPasswordAge      = engine.NewAttribute("msDS-MaximumPasswordAge").Tag("AD").Type(engine.AttributeTypeInt)
+	MSDSLockoutThreshold        = engine.NewAttribute("msDS-LockoutThreshold").Tag("AD").Type(engine.AttributeTypeInt)
+	MSDSPasswordComplexity      = engine.NewAttribute("msDS-PasswordComplexityEnabled").Tag("AD")
+	MSDSReplAttributeMetaData   = engine.NewAttribute("msDS-ReplAttributeMetaData").Tag("AD")
+	MSDSReplValueMetaData       = engine.NewAttribute("msDS-ReplValueMetaData").Tag("AD")
+)
+
+var (
+	MetaTrustSIDFiltering            = engine.NewAttribute("_trustsidfiltering")
+	MetaTrustSelectiveAuthentication = engine.NewAttribute("_trustselectiveauthentication")
+	MetaTrustTGTDelegation           = engine.NewAttribute("_trusttgtdelegation")
+	MetaTrustTransitive              = engine.NewAttribute("_trusttransitive")
+	MetaLAPSAuthorizedDecryptor      = engine.NewAttribute("_lapsauthorizeddecryptor")
+	MetaKeyCredentialID              = engine.NewAttribute("_keycredentialid")
+	MetaKeyCredentialCreated         = engine.NewAttribute("_keycredentialcreated").Type(engine.AttributeTypeTime)
+	MetaKeyCredentialDeviceID        = engine.NewAttribute("_keycredentialdeviceid").Type(engine.AttributeTypeGUID)
+	MetaUnregisteredKeyCredential    = engine.NewAttribute("_unregisteredkeycredential")
+	MetaRODC                         = engine.NewAttribute("_rodc")
+	MetaRODCRevealable               = engine.NewAttribute("_rodcrevealable")
+	MetaRODCRevealablePrivileged     = engine.NewAttribute("_rodcrevealableprivileged")
+	MetaPasswordPolicy               = engine.NewAttribute("_passwordpolicy")
+	MetaPasswordMinLength            = engine.NewAttribute("_passwordminlength")
+	MetaPasswordMaxAge               = engine.NewAttribute("_passwordmaxage")
+	MetaPasswordComplexity           = engine.NewAttribute("_passwordcomplexity")
+	MetaLockoutThreshold             = engine.NewAttribute("_lockoutthreshold")
+	MetaLastChange                   = engine.NewAttribute("_lastchange").Type(engine.AttributeTypeTime)
+	MetaReplChanges                  = engine.NewAttribute("_replchanges")
+	MetaLinkChanges                  = engine.NewAttribute("_linkchanges")
+	MetaSecurityDescriptorChange     = engine.NewAttribute("_securitydescriptorchange").Type(engine.AttributeTypeTime)
+	MetaMemberChange                 = engine.NewAttribute("_memberchange").Type(engine.AttributeTypeTime)
+	MetaMemberOfChange               = engine.NewAttribute("_memberofchange").Type(engine.AttributeTypeTime)
+	MetaAdminSDHolderDrift           = engine.NewAttribute("_adminsdholderdrift")
+	MetaOrphanedAdminCount           = engine.NewAttribute("_orphanedadmincount")
+	MetaADSyncAccount                = engine.NewAttribute("_adsyncaccount")
+	MetaADSyncServer                 = engine.NewAttribute("_adsyncserver")
+	MetaGPOLSAProtection             = engine.NewAttribute("_gpolsaprotection")
+	MetaGPOWDigest                   = engine.NewAttribute("_gpowdigest")
+	MetaGPOLAPSEnabled               = engine.NewAttribute("_gpolapsenabled")
+	MetaGPOLDAPServerIntegrity       = engine.NewAttribute("_gpoldapserverintegrity")
+	MetaGPOLDAPClientIntegrity       = engine.NewAttribute("_gpoldapclientintegrity")
+	MetaGPOLMCompatibilityLevel      = engine.NewAttribute("_gpolmcompatibilitylevel")
+	MetaGPORestrictSendingNTLM       = engine.NewAttribute("_gporestrictsendingntlm")
+	MetaGPORestrictReceivingNTLM     = engine.NewAttribute("_gporestrictreceivingntlm")
+	MetaGPOAutoAdminLogon            = engine.NewAttribute("_gpoautoadminlogon")
+	MetaGPOAutoAdminLogonUser        = engine.NewAttribute("_gpoautoadminlogonuser")
+	MetaAppliedGPOs                  = engine.NewAttribute("_appliedgpos")
+	MetaGPOWMIFilter                 = engine.NewAttribute("_gpowmifilter")
+	MetaUnparsedCPassword            = engine.NewAttribute("_unparsedcpassword")
+)
+
+// Scheduled tasks, both from GPO preferences and collected from machines
+var (
+	TaskRunAs       = engine.NewAttribute("taskRunAs").Single()
+	TaskLogonType   = engine.NewAttribute("taskLogonType").Single()
+	TaskRunLevel    = engine.NewAttribute("taskRunLevel").Single()
+	TaskCommandLine = engine.NewAttribute("taskCommandLine")
 )
@@ -2,7 +2,9 @@ package collect
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"strconv"
 	"strings"
@@ -11,7 +13,10 @@ import (
 
 	"github.com/gofrs/uuid"
 	"github.com/lkarlslund/adalanche/modules/integrations/activedirectory"
+	"github.com/lkarlslund/adalanche/modules/util"
 	"github.com/lkarlslund/binstruct"
+	"github.com/rs/zerolog/log"
+	"github.com/schollz/progressbar/v3"
 )
 
 type ADEXAttributeType uint32
@@ -61,54 +66,67 @@ type ADEXHeader struct {
 
 	OffsetPRC uint64
 	OffsetEnd uint64
+}
 
-	Properties ADEXProperties `bin:"offsetStart:OffsetPRC"`
-	Classes    ADEXClasses
-	Rights     ADEXRights
+var (
+	ErrADEXCorrupt            = errors.New("AD Explorer snapshot is corrupt")
+	ErrADEXTruncated          = errors.New("AD Explorer snapshot is truncated")
+	ErrADEXUnsupportedVersion = errors.New("unsupported AD Explorer snapshot format version")
+)
 
-	Objects []ADEXObject `bin:"len:ObjectCount,offsetStart:1086"`
+// adexLayout describes where things are in a particular snapshot format version
+type adexLayout struct {
+	headerSize int64 // Size of the fixed header, objects start right after it
 }
 
+// Snapshot format layouts by major version (high word of the header version), and the exact versions they were verified against.
+// Only the version 1 layout written by current AD Explorer releases is known, other major versions are rejected rather than guessed
+var (
+	adexLayouts = map[uint32]adexLayout{
+		1: {
+			headerSize: 1086,
+		},
+	}
+	adexVerifiedVersions = map[uint32]struct{}{
+		0x00010001: {},
+	}
+)
+
+// Smallest possible header, used to reject files before we know the version
+const adexMinHeaderSize = 1086
+
+// Smallest possible attribute definition: two empty strings, three uint32s and two GUIDs
+const adexMinPropertySize = 4 + 4 + 4 + 4 + 16 + 16 + 4
+
 type ADEXObject struct {
-	Position CurrentPosition
+	Position int64
 	Size     uint32
-	Count    uint32
-	Entries  []ADEXEntry `bin:"len:Count"`
-	Blob     struct{}    `bin:"SkipData"`
-}
-
-func (o *ADEXObject) SkipData(r binstruct.Reader) error {
-	skip := int64(o.Size - 8 - o.Count*8)
-	if skip < 0 {
-		return fmt.Errorf("invalid object size %v", o.Size)
-	}
-	_, err := r.Seek(skip, os.SEEK_CUR)
-	return err
+	Entries  []ADEXEntry
 }
 
-func (o *ADEXObject) GetValues(r *binstruct.Decoder, attr []ADEXProperty, offsetcache map[int64][]string) (map[string][]string, error) {
+func (o *ADEXObject) GetValues(r *binstruct.Decoder, attr []ADEXProperty, filesize int64) (map[string][]string, error) {
 	results := make(map[string][]string)
 	for _, e := range o.Entries {
+		if int(e.Attribute) >= len(attr) {
+			return nil, fmt.Errorf("%w: attribute index %v out of range (%v attributes)", ErrADEXCorrupt, e.Attribute, len(attr))
+		}
 		a := attr[e.Attribute]
 
-		if cachedvalues, found := offsetcache[int64(o.Position)+int64(e.Offset)]; found {
-			results[string(a.Name)] = cachedvalues
-			continue
+		position := o.Position + int64(e.Offset)
+		if position < 0 || position+4 > filesize {
+			return nil, fmt.Errorf("%w: attribute %v value offset %v is outside file", ErrADEXCorrupt, a.Name, position)
 		}
 
 		ad := AttributeDecoder{
 			attributeType: ADEXAttributeType(a.Encoding),
-			position:      int64(o.Position) + int64(e.Offset),
+			position:      position,
+			filesize:      filesize,
 		}
 		err := r.Decode(&ad)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("attribute %v: %v", a.Name, err)
 		}
 
-		// Save to the cache
-		offsetcache[int64(o.Position)+int64(e.Offset)] = ad.results
-
-		// Add to the result
 		results[string(a.Name)] = ad.results
 	}
 	return results, nil
@@ -117,17 +135,23 @@ func (o *ADEXObject) GetValues(r *binstruct.Decoder, attr []ADEXProperty, offset
 type AttributeDecoder struct {
 	attributeType ADEXAttributeType
 	position      int64
-	size          uint32
+	filesize      int64
 	results       []string
 }
 
 func (ad *AttributeDecoder) BinaryDecode(r binstruct.Reader) error {
-	r.Seek(int64(ad.position), os.SEEK_SET)
+	_, err := r.Seek(int64(ad.position), io.SeekStart)
+	if err != nil {
+		return err
+	}
 
 	count, err := r.ReadUint32()
 	if err != nil {
 		return err
 	}
+	if int64(count)*4 > ad.filesize-ad.position {
+		return fmt.Errorf("%w: value count %v exceeds file size", ErrADEXCorrupt, count)
+	}
 
 	ad.results = make([]string, count, count)
 
@@ -158,8 +182,14 @@ func (ad *AttributeDecoder) BinaryDecode(r binstruct.Reader) error {
 			}
 
 			thispos := ad.position + int64(localoffsets[i])
+			if thispos >= ad.filesize {
+				return fmt.Errorf("%w: string value offset %v is outside file", ErrADEXCorrupt, thispos)
+			}
 
-			r.Seek(thispos, os.SEEK_SET)
+			_, err = r.Seek(thispos, io.SeekStart)
+			if err != nil {
+				return err
+			}
 
 			var wc WCstring
 			err = r.Unmarshal(&wc)
@@ -179,6 +209,9 @@ func (ad *AttributeDecoder) BinaryDecode(r binstruct.Reader) error {
 				}
 			}
 
+			if int64(localoffsets[i]) > ad.filesize {
+				return fmt.Errorf("%w: binary value length %v exceeds file size", ErrADEXCorrupt, localoffsets[i])
+			}
 			_, s, err := r.ReadBytes(int(localoffsets[i]))
 			if err != nil {
 				return err
@@ -307,19 +340,11 @@ func (st *SystemTime) Time() time.Time {
 	return time.Date(int(st.Year), time.Month(st.Month), int(st.Day), int(st.Hour), int(st.Minute), int(st.Second), int(st.Milliseconds), time.UTC)
 }
 
-type CurrentPosition int64
-
-func (cp *CurrentPosition) BinaryDecode(r binstruct.Reader) error {
-	pos, err := r.Seek(0, os.SEEK_CUR)
-	if err != nil {
-		return err
-	}
-	*cp = CurrentPosition(uint64(pos))
-	return nil
-}
-
 type WStringLength string
 
+// Longest length prefixed string we accept, names and DNs in snapshots are much shorter than this
+const maxWStringLength = 65536
+
 func (wsl *WStringLength) BinaryDecode(r binstruct.Reader) error {
 	length, err := r.ReadUint32()
 	if err != nil {
@@ -329,6 +354,9 @@ func (wsl *WStringLength) BinaryDecode(r binstruct.Reader) error {
 	if length == 0 {
 		return nil
 	}
+	if length > maxWStringLength {
+		return fmt.Errorf("%w: string length %v is too long", ErrADEXCorrupt, length)
+	}
 
 	data := make([]uint16, int(length)/2, int(length)/2)
 
@@ -405,48 +433,150 @@ type AttributeValueData struct {
 	LocalOffsets []uint32 `bin:"len:Count"`
 }
 
-func DumpFromADExplorer(path string) ([]activedirectory.RawObject, error) {
+// DumpFromADExplorer streams all objects from an AD Explorer snapshot to the callback
+func DumpFromADExplorer(path string, onobject func(ro *activedirectory.RawObject) error) error {
 	raw, err := os.Open(path)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	defer raw.Close()
 
-	// Header
+	stat, err := raw.Stat()
+	if err != nil {
+		return err
+	}
+	filesize := stat.Size()
+	if filesize < adexMinHeaderSize {
+		return fmt.Errorf("%w: %v is too small to be an AD Explorer snapshot (%v bytes)", ErrADEXTruncated, path, filesize)
+	}
+
+	signature := make([]byte, 10)
+	_, err = io.ReadFull(raw, signature)
+	if err != nil {
+		return err
+	}
+	if string(signature) != "win-ad-ob\x00" {
+		return fmt.Errorf("invalid AD Explorer snapshot signature %q", strings.TrimRight(string(signature), "\x00"))
+	}
+	_, err = raw.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
 
 	dec := binstruct.NewDecoder(raw, binary.LittleEndian)
 
 	var header ADEXHeader
 	err = dec.Decode(&header)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode header: %v", err)
+		return fmt.Errorf("failed to decode header: %v", err)
 	}
 
-	if header.Signature != "win-ad-ob" {
-		return nil, fmt.Errorf("Invalid AD Explorer data file signature: %v", header.Signature)
+	layout, found := adexLayouts[header.Version>>16]
+	if !found {
+		return fmt.Errorf("%w %v.%v", ErrADEXUnsupportedVersion, header.Version>>16, header.Version&0xffff)
 	}
+	if _, verified := adexVerifiedVersions[header.Version]; !verified {
+		log.Warn().Msgf("Untested AD Explorer snapshot format version %v.%v, attempting import with the version %v layout", header.Version>>16, header.Version&0xffff, header.Version>>16)
+	}
+
+	log.Info().Msgf("AD Explorer snapshot of %v taken %v, format version %v.%v, %v objects",
+		header.Server, util.FiletimeToTime(header.FileTime).Format(time.RFC3339), header.Version>>16, header.Version&0xffff, header.ObjectCount)
 
-	if header.Version != 0x00010001 {
-		return nil, fmt.Errorf("Invalid AD Explorer data file marker: %v", header.Version)
+	if int64(header.OffsetEnd) > filesize {
+		return fmt.Errorf("%w: %v expected at least %v bytes, but file is %v bytes", ErrADEXTruncated, path, header.OffsetEnd, filesize)
+	}
+	if int64(header.OffsetPRC) < layout.headerSize || int64(header.OffsetPRC) >= filesize {
+		return fmt.Errorf("%w: %v schema offset %v outside file of %v bytes", ErrADEXCorrupt, path, header.OffsetPRC, filesize)
+	}
+	if int64(header.ObjectCount)*8 > int64(header.OffsetPRC) {
+		return fmt.Errorf("%w: %v object count %v does not fit in file", ErrADEXCorrupt, path, header.ObjectCount)
+	}
+
+	_, err = raw.Seek(int64(header.OffsetPRC), io.SeekStart)
+	if err != nil {
+		return err
+	}
+	var properties ADEXProperties
+	err = binary.Read(raw, binary.LittleEndian, &properties.Count)
+	if err != nil {
+		return fmt.Errorf("failed to decode attribute definitions: %w", err)
+	}
+	if int64(properties.Count)*adexMinPropertySize > filesize-int64(header.OffsetPRC) {
+		return fmt.Errorf("%w: %v attribute count %v does not fit in file", ErrADEXCorrupt, path, properties.Count)
+	}
+	properties.Props = make([]ADEXProperty, properties.Count)
+	for i := range properties.Props {
+		err = dec.Decode(&properties.Props[i])
+		if err != nil {
+			return fmt.Errorf("failed to decode attribute definition %v: %w", i, err)
+		}
 	}
 
-	ao := make([]activedirectory.RawObject, header.ObjectCount)
+	bar := progressbar.NewOptions(int(header.ObjectCount),
+		progressbar.OptionSetDescription("Reading from "+path+" ..."),
+		progressbar.OptionShowCount(),
+		progressbar.OptionShowIts(),
+		progressbar.OptionSetItsString("objects"),
+		progressbar.OptionOnCompletion(func() { fmt.Println() }),
+		progressbar.OptionThrottle(time.Second*1),
+	)
+	defer bar.Finish()
+
+	position := layout.headerSize
+	objectheader := make([]byte, 8)
+	for i := 0; i < int(header.ObjectCount); i++ {
+		if position+8 > int64(header.OffsetPRC) {
+			return fmt.Errorf("%w: %v object %d at offset %v overlaps schema data", ErrADEXCorrupt, path, i, position)
+		}
 
-	offsetcache := make(map[int64][]string)
+		_, err = raw.ReadAt(objectheader, position)
+		if err != nil {
+			return fmt.Errorf("failed to read object %d: %v", i, err)
+		}
 
-	for i, ado := range header.Objects {
-		var ro activedirectory.RawObject
-		ro.Attributes = make(map[string][]string)
+		ado := ADEXObject{
+			Position: position,
+			Size:     binary.LittleEndian.Uint32(objectheader[0:]),
+		}
+		count := binary.LittleEndian.Uint32(objectheader[4:])
+		if int64(ado.Size) < 8+int64(count)*8 || position+int64(ado.Size) > int64(header.OffsetPRC) {
+			return fmt.Errorf("%w: %v object %d at offset %v has invalid size %v", ErrADEXCorrupt, path, i, position, ado.Size)
+		}
+
+		entries := make([]byte, count*8)
+		_, err = raw.ReadAt(entries, position+8)
+		if err != nil {
+			return fmt.Errorf("failed to read object %d: %v", i, err)
+		}
+		ado.Entries = make([]ADEXEntry, count)
+		for j := range ado.Entries {
+			ado.Entries[j].Attribute = binary.LittleEndian.Uint32(entries[j*8:])
+			ado.Entries[j].Offset = int32(binary.LittleEndian.Uint32(entries[j*8+4:]))
+		}
 
-		values, err := ado.GetValues(dec, header.Properties.Props, offsetcache)
+		values, err := ado.GetValues(dec, properties.Props, filesize)
 		if err != nil {
-			return nil, fmt.Errorf("failed to get values for object %d: %v", i, err)
+			return fmt.Errorf("failed to get values for object %d at offset %v: %w", i, position, err)
 		}
 
+		var ro activedirectory.RawObject
 		ro.Attributes = values
-		ro.DistinguishedName = ro.Attributes["distinguishedName"][0]
+		if dn := ro.Attributes["distinguishedName"]; len(dn) > 0 {
+			ro.DistinguishedName = dn[0]
+		} else {
+			log.Warn().Msgf("Object %d at offset %v has no distinguishedName, skipping", i, position)
+		}
 
-		ao[i] = ro
+		if ro.DistinguishedName != "" {
+			err = onobject(&ro)
+			if err != nil {
+				return err
+			}
+		}
+
+		position += int64(ado.Size)
+		bar.Add(1)
 	}
 
-	return ao, nil
+	return nil
 }
@@ -0,0 +1,115 @@
+package collect
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/lkarlslund/adalanche/modules/integrations/activedirectory"
+)
+
+// adexSnapshot holds the knobs for building a minimal snapshot with one object that only has a distinguishedName
+type adexSnapshot struct {
+	version       uint32
+	propertycount uint32
+	attributeidx  uint32
+	truncate      int
+}
+
+func adexUTF16(s string) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, utf16.Encode([]rune(s+"\x00")))
+	return buf.Bytes()
+}
+
+func (s adexSnapshot) build() []byte {
+	le := binary.LittleEndian
+
+	var object bytes.Buffer
+	dn := adexUTF16("CN=x")
+	binary.Write(&object, le, uint32(16+8+len(dn))) // Size
+	binary.Write(&object, le, uint32(1))            // Entry count
+	binary.Write(&object, le, s.attributeidx)       // Attribute
+	binary.Write(&object, le, uint32(16))           // Value offset
+	binary.Write(&object, le, uint32(1))            // Value count
+	binary.Write(&object, le, uint32(8))            // String offset
+	object.Write(dn)
+
+	var properties bytes.Buffer
+	name := adexUTF16("distinguishedName")
+	binary.Write(&properties, le, s.propertycount)
+	binary.Write(&properties, le, uint32(len(name)))
+	properties.Write(name)
+	binary.Write(&properties, le, []uint32{0, uint32(ADSTYPE_DN_STRING), 0}) // Unknown, encoding, empty DN
+	properties.Write(make([]byte, 16+16+4))                                  // GUIDs and blob
+
+	offsetprc := uint64(adexMinHeaderSize + object.Len())
+	offsetend := offsetprc + uint64(properties.Len())
+
+	var snapshot bytes.Buffer
+	snapshot.WriteString("win-ad-ob\x00")
+	binary.Write(&snapshot, le, s.version)
+	snapshot.Write(make([]byte, 8+520+520)) // Filetime, description and server
+	binary.Write(&snapshot, le, uint32(1))  // Object count
+	binary.Write(&snapshot, le, uint32(1))  // Attribute count
+	binary.Write(&snapshot, le, offsetprc)
+	binary.Write(&snapshot, le, offsetend)
+	snapshot.Write(object.Bytes())
+	snapshot.Write(properties.Bytes())
+
+	data := snapshot.Bytes()
+	if s.truncate > 0 {
+		data = data[:s.truncate]
+	}
+	return data
+}
+
+func TestDumpFromADExplorer(t *testing.T) {
+	valid := adexSnapshot{version: 0x00010001, propertycount: 1}
+
+	tests := []struct {
+		name   string
+		modify func(s *adexSnapshot)
+		want   error
+	}{
+		{"valid", func(s *adexSnapshot) {}, nil},
+		{"untested minor version", func(s *adexSnapshot) { s.version = 0x00010002 }, nil},
+		{"unknown major version", func(s *adexSnapshot) { s.version = 0x00020000 }, ErrADEXUnsupportedVersion},
+		{"short header", func(s *adexSnapshot) { s.truncate = 100 }, ErrADEXTruncated},
+		{"truncated", func(s *adexSnapshot) { s.truncate = 1100 }, ErrADEXTruncated},
+		{"attribute count", func(s *adexSnapshot) { s.propertycount = 100000 }, ErrADEXCorrupt},
+		{"attribute index", func(s *adexSnapshot) { s.attributeidx = 5 }, ErrADEXCorrupt},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := valid
+			tt.modify(&s)
+			path := filepath.Join(t.TempDir(), "snapshot.dat")
+			if err := os.WriteFile(path, s.build(), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			var dns []string
+			err := DumpFromADExplorer(path, func(ro *activedirectory.RawObject) error {
+				dns = append(dns, ro.DistinguishedName)
+				return nil
+			})
+			if tt.want != nil {
+				if !errors.Is(err, tt.want) {
+					t.Fatalf("got error %v, want %v", err, tt.want)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if len(dns) != 1 || dns[0] != "CN=x" {
+				t.Errorf("got objects %q, want [CN=x]", dns)
+			}
+		})
+	}
+}
@@ -38,6 +38,7 @@ var (
 	autodetect = Command.Flags().Bool("autodetect", true, "Try to autodetect as much as we can, this will use environment variables and DNS to make this easy")
 
 	adexplorerfile = Command.Flags().String("adexplorerfile", "", "Import AD objects from SysInternals ADexplorer dump")
+	ntdsfile       = Command.Flags().String("ntdsfile", "", "Import AD objects from offline copy of NTDS.dit database")
 
 	server = Command.Flags().String("server", "", "DC to connect to, use IP or full hostname ex. -dc=\"dc.contoso.local\", random DC is auto-detected if not supplied")
 	port   = Command.Flags().Int("port", 636, "LDAP port to connect to (389 or 636 typical)")
@@ -56,6 +57,8 @@ var (
 	authdomain      = Command.Flags().String("authdomain", "", "domain for authentication, if using ntlm auth")
 	attributesparam = Command.Flags().String("attributes", "*", "Comma seperated list of attributes to get, * = all, or a comma seperated list of attribute names (expert)")
 
+	replmetadata = Command.Flags().Bool("replmetadata", false, "Request replication metadata for objects, allows finding recently changed attributes and group memberships (roughly doubles LDAP traffic)")
+
 	nosacl   = Command.Flags().Bool("nosacl", true, "Request data with NO SACL flag, allows normal users to dump ntSecurityDescriptor field")
 	pagesize = Command.Flags().Int("pagesize", 1000, "Number of objects per request to collect (increase for performance, but some DCs have limits)")
 
@@ -66,6 +69,9 @@ var (
 	collectgpos          = Command.Flags().String("gpos", "auto", "Collect Group Policy file contents")
 	gpopath              = Command.Flags().String("gpopath", "", "Override path to GPOs, useful for non Windows OS'es with mounted drive (/mnt/policies/ or similar), but will break ACL feature")
 
+	forest            = Command.Flags().Bool("forest", false, "Collect all domains in the forest, each domain is saved in a subfolder of the datapath")
+	forestconcurrency = Command.Flags().Int("forestconcurrency", 2, "Number of domains to collect in parallel when using --forest")
+
 	authmode AuthMode
 	tlsmode  TLSmode
 )
@@ -85,7 +91,7 @@ func init() {
 
 // Checks that we have enough data to proceed with the real run
 func PreRun(cmd *cobra.Command, args []string) error {
-	if *adexplorerfile != "" {
+	if *adexplorerfile != "" || *ntdsfile != "" {
 		// That's all we need for this run to work
 		return nil
 	}
@@ -202,333 +208,408 @@ func Execute(cmd *cobra.Command, args []string) error {
 
 	var gpostocollect []*activedirectory.RawObject
 
+	cp, _ := util.ParseBool(*collectgpos)
+	collectgpo := func(ro *activedirectory.RawObject) {
+		if *collectgpos == "auto" || cp {
+			if _, found := ro.Attributes["gPCFileSysPath"]; found {
+				gpostocollect = append(gpostocollect, ro)
+			}
+		}
+	}
+
 	if *adexplorerfile != "" {
 		// Active Directory Explorer file
 		log.Info().Msgf("Reading AD explorer file %v", *adexplorerfile)
-		rao, err := DumpFromADExplorer(*adexplorerfile)
+
+		outpath := filepath.Join(datapath, filepath.Base(*adexplorerfile)+".objects.msgp.lz4")
+		e, closer, err := createObjectsFile(outpath)
 		if err != nil {
 			return err
 		}
 
-		var e *msgp.Writer
-
-		outfile, err := os.Create(filepath.Join(datapath, filepath.Base(*adexplorerfile)+".objects.msgp.lz4"))
+		err = DumpFromADExplorer(*adexplorerfile, func(ro *activedirectory.RawObject) error {
+			err := ro.EncodeMsg(e)
+			if err != nil {
+				return fmt.Errorf("problem encoding LDAP object %v: %v", ro.DistinguishedName, err)
+			}
+			collectgpo(ro)
+			return nil
+		})
+		if err == nil {
+			err = closer()
+		} else {
+			closer()
+			os.Remove(outpath)
+		}
 		if err != nil {
-			return fmt.Errorf("problem opening domain cache file: %v", err)
+			return err
 		}
-		defer outfile.Close()
-
-		boutfile := lz4.NewWriter(outfile)
-		lz4options := []lz4.Option{
-			lz4.BlockChecksumOption(true),
-			// lz4.BlockSizeOption(lz4.BlockSize(51 * 1024)),
-			lz4.ChecksumOption(true),
-			lz4.CompressionLevelOption(lz4.Level9),
-			lz4.ConcurrencyOption(-1),
+	} else if *ntdsfile != "" {
+		// Offline NTDS.dit database
+		log.Info().Msgf("Reading NTDS database %v", *ntdsfile)
+
+		outpath := filepath.Join(datapath, filepath.Base(*ntdsfile)+".objects.msgp.lz4")
+		e, closer, err := createObjectsFile(outpath)
+		if err != nil {
+			return err
 		}
-		boutfile.Apply(lz4options...)
-		defer boutfile.Close()
-		e = msgp.NewWriter(boutfile)
 
-		for _, ro := range rao {
-			err = ro.EncodeMsg(e)
+		err = DumpFromNTDS(*ntdsfile, func(ro *activedirectory.RawObject) error {
+			err := ro.EncodeMsg(e)
 			if err != nil {
-				return fmt.Errorf("problem encoding LDAP object %v: %v", ro.DistinguishedName, err)
+				return fmt.Errorf("problem encoding NTDS object %v: %v", ro.DistinguishedName, err)
 			}
+			collectgpo(ro)
+			return nil
+		})
+		if err == nil {
+			err = closer()
+		} else {
+			closer()
+			os.Remove(outpath)
 		}
-
-		cp, _ := util.ParseBool(*collectgpos)
-		if *collectgpos == "auto" || cp {
-			for _, ro := range rao {
-				if _, found := ro.Attributes["gPCFileSysPath"]; found {
-					myro := ro
-					gpostocollect = append(gpostocollect, &myro)
-				}
-			}
+		if err != nil {
+			return err
 		}
+	} else if *forest {
+		// Every domain in the forest, each in its own subfolder
+		return dumpForest(ldapOptions(), datapath)
 	} else {
 		// Active Directory dump directly from AD controller
-		options := LDAPOptions{
-			Domain:     *domain,
-			Server:     *server,
-			Port:       uint16(*port),
-			AuthMode:   authmode,
-			User:       *user,
-			Password:   *pass,
-			AuthDomain: *authdomain,
-			TLSMode:    tlsmode,
-			IgnoreCert: *ignoreCert,
-			Debug:      *ldapdebug,
+		err := dumpDomain(ldapOptions(), datapath, collectgpo)
+		if err != nil {
+			return err
 		}
+	}
 
-		var ad LDAPDumper
+	if *collectgpos == "auto" || cp {
+		collectGPOFiles(datapath, gpostocollect)
+	}
 
-		ad = CreateDumper(options)
+	return nil
+}
 
-		err := ad.Connect()
-		if err != nil {
-			return errors.Wrap(err, "problem connecting to AD")
-		}
+func ldapOptions() LDAPOptions {
+	return LDAPOptions{
+		Domain:     *domain,
+		Server:     *server,
+		Port:       uint16(*port),
+		AuthMode:   authmode,
+		User:       *user,
+		Password:   *pass,
+		AuthDomain: *authdomain,
+		TLSMode:    tlsmode,
+		IgnoreCert: *ignoreCert,
+		Debug:      *ldapdebug,
+	}
+}
 
-		var attributes []string
-		switch *attributesparam {
-		case "*":
-			// don't do anything
-		default:
-			attributes = strings.Split(*attributesparam, ",")
-		}
+// dumpDomain collects all naming contexts from a DC into datapath
+func dumpDomain(options LDAPOptions, datapath string, onobject func(ro *activedirectory.RawObject)) error {
+	var ad LDAPDumper
 
-		log.Info().Msg("Probing RootDSE ...")
-		rootdse, err := ad.Dump(DumpOptions{
-			SearchBase:    "",
-			Query:         "(objectClass=*)",
-			Scope:         ldap.ScopeBaseObject,
-			ReturnObjects: true,
-		})
-		if err != nil {
-			return fmt.Errorf("problem querying Active Directory RootDSE: %w", err)
-		}
-		if len(rootdse) != 1 {
-			return fmt.Errorf("expected 1 Active Directory RootDSE object, but got %v", len(rootdse))
-		}
+	ad = CreateDumper(options)
 
-		var domainContext string
+	err := ad.Connect()
+	if err != nil {
+		return errors.Wrap(err, "problem connecting to AD")
+	}
 
-		rd := rootdse[0]
+	var attributes []string
+	switch *attributesparam {
+	case "*":
+		// don't do anything
+	default:
+		attributes = strings.Split(*attributesparam, ",")
+	}
 
-		namingcontexts := map[string]bool{}
-		for _, context := range rd.Attributes["namingContexts"] {
-			namingcontexts[context] = false
-		}
+	log.Info().Msg("Probing RootDSE ...")
+	rootdse, err := ad.Dump(DumpOptions{
+		SearchBase:    "",
+		Query:         "(objectClass=*)",
+		Scope:         ldap.ScopeBaseObject,
+		ReturnObjects: true,
+	})
+	if err != nil {
+		return fmt.Errorf("problem querying Active Directory RootDSE: %w", err)
+	}
+	if len(rootdse) != 1 {
+		return fmt.Errorf("expected 1 Active Directory RootDSE object, but got %v", len(rootdse))
+	}
 
-		var configContext string
-		if len(rd.Attributes["configurationNamingContext"]) > 0 {
-			configContext = rd.Attributes["configurationNamingContext"][0]
-			namingcontexts[configContext] = true
-		}
+	var domainContext string
 
-		if len(rd.Attributes["defaultNamingContext"]) > 0 {
-			domainContext = rd.Attributes["defaultNamingContext"][0]
-			namingcontexts[domainContext] = true
-		}
+	rd := rootdse[0]
 
-		var rootDomainContext string
-		if len(rd.Attributes["rootDomainNamingContext"]) > 0 {
-			rootDomainContext = rd.Attributes["rootDomainNamingContext"][0]
-			namingcontexts[rootDomainContext] = true
-		}
+	namingcontexts := map[string]bool{}
+	for _, context := range rd.Attributes["namingContexts"] {
+		namingcontexts[context] = false
+	}
 
-		var schemaContext string
-		if len(rd.Attributes["schemaNamingContext"]) > 0 {
-			schemaContext = rd.Attributes["schemaNamingContext"][0]
-			namingcontexts[schemaContext] = true
-		}
+	var configContext string
+	if len(rd.Attributes["configurationNamingContext"]) > 0 {
+		configContext = rd.Attributes["configurationNamingContext"][0]
+		namingcontexts[configContext] = true
+	}
 
-		var otherContexts []string
-		for context, used := range namingcontexts {
-			if !used {
-				otherContexts = append(otherContexts, context)
-			}
-		}
+	if len(rd.Attributes["defaultNamingContext"]) > 0 {
+		domainContext = rd.Attributes["defaultNamingContext"][0]
+		namingcontexts[domainContext] = true
+	}
 
-		log.Info().Msg("Saving RootDSE ...")
-		_, err = ad.Dump(DumpOptions{
-			SearchBase:  "",
-			Scope:       ldap.ScopeBaseObject,
-			WriteToFile: filepath.Join(datapath, domainContext+".RootDSE.objects.msgp.lz4"),
-		})
-		if err != nil {
-			return fmt.Errorf("problem saving Active Directory RootDSE: %w", err)
-		}
+	var rootDomainContext string
+	if len(rd.Attributes["rootDomainNamingContext"]) > 0 {
+		rootDomainContext = rd.Attributes["rootDomainNamingContext"][0]
+		namingcontexts[rootDomainContext] = true
+	}
+
+	var schemaContext string
+	if len(rd.Attributes["schemaNamingContext"]) > 0 {
+		schemaContext = rd.Attributes["schemaNamingContext"][0]
+		namingcontexts[schemaContext] = true
+	}
 
-		if len(rootdse) != 1 {
-			log.Error().Msgf("Expected 1 Active Directory RootDSE object, but got %v", len(rootdse))
+	var otherContexts []string
+	for context, used := range namingcontexts {
+		if !used {
+			otherContexts = append(otherContexts, context)
 		}
+	}
+
+	log.Info().Msg("Saving RootDSE ...")
+	_, err = ad.Dump(DumpOptions{
+		SearchBase:  "",
+		Scope:       ldap.ScopeBaseObject,
+		WriteToFile: filepath.Join(datapath, domainContext+".RootDSE.objects.msgp.lz4"),
+	})
+	if err != nil {
+		return fmt.Errorf("problem saving Active Directory RootDSE: %w", err)
+	}
+
+	if len(rootdse) != 1 {
+		log.Error().Msgf("Expected 1 Active Directory RootDSE object, but got %v", len(rootdse))
+	}
 
-		do := DumpOptions{
-			Attributes:    attributes,
-			Query:         "(objectClass=*)",
-			Scope:         ldap.ScopeWholeSubtree,
-			NoSACL:        *nosacl,
-			ChunkSize:     *pagesize,
-			ReturnObjects: false,
+	do := DumpOptions{
+		Attributes:    attributes,
+		Query:         "(objectClass=*)",
+		Scope:         ldap.ScopeWholeSubtree,
+		NoSACL:        *nosacl,
+		ChunkSize:     *pagesize,
+		ReturnObjects: false,
+	}
+
+	cs, _ := util.ParseBool(*collectschema)
+	if (*collectschema == "auto" && schemaContext != "") || cs {
+		log.Info().Msg("Collecting schema objects ...")
+		do.SearchBase = schemaContext
+		do.WriteToFile = filepath.Join(datapath, do.SearchBase+".objects.msgp.lz4")
+		_, err = ad.Dump(do)
+		if err != nil {
+			os.Remove(do.WriteToFile)
+			return fmt.Errorf("problem collecting Active Directory schema objects: %v", err)
 		}
+	}
 
-		cs, _ := util.ParseBool(*collectschema)
-		if (*collectschema == "auto" && schemaContext != "") || cs {
-			log.Info().Msg("Collecting schema objects ...")
-			do.SearchBase = schemaContext
-			do.WriteToFile = filepath.Join(datapath, do.SearchBase+".objects.msgp.lz4")
-			_, err = ad.Dump(do)
-			if err != nil {
-				os.Remove(do.WriteToFile)
-				return fmt.Errorf("problem collecting Active Directory schema objects: %v", err)
-			}
+	cs, _ = util.ParseBool(*collectconfiguration)
+	if (*collectconfiguration == "auto" && configContext != "") || cs {
+		log.Info().Msg("Collecting configuration objects ...")
+		do.SearchBase = configContext
+		do.WriteToFile = filepath.Join(datapath, do.SearchBase+".objects.msgp.lz4")
+		_, err = ad.Dump(do)
+		if err != nil {
+			os.Remove(do.WriteToFile)
+			return fmt.Errorf("problem collecting Active Directory configuration objects: %v", err)
 		}
+	}
 
-		cs, _ = util.ParseBool(*collectconfiguration)
-		if (*collectconfiguration == "auto" && configContext != "") || cs {
-			log.Info().Msg("Collecting configuration objects ...")
-			do.SearchBase = configContext
+	cs, _ = util.ParseBool(*collectother)
+	if (*collectother == "auto" && len(otherContexts) > 0) || cs {
+		log.Info().Msg("Collecting other objects ...")
+		for _, context := range otherContexts {
+			log.Info().Msgf("Collecting from base DN %v ...", context)
+			do.SearchBase = context
 			do.WriteToFile = filepath.Join(datapath, do.SearchBase+".objects.msgp.lz4")
 			_, err = ad.Dump(do)
 			if err != nil {
 				os.Remove(do.WriteToFile)
-				return fmt.Errorf("problem collecting Active Directory configuration objects: %v", err)
-			}
-		}
-
-		cs, _ = util.ParseBool(*collectother)
-		if (*collectother == "auto" && len(otherContexts) > 0) || cs {
-			log.Info().Msg("Collecting other objects ...")
-			for _, context := range otherContexts {
-				log.Info().Msgf("Collecting from base DN %v ...", context)
-				do.SearchBase = context
-				do.WriteToFile = filepath.Join(datapath, do.SearchBase+".objects.msgp.lz4")
-				_, err = ad.Dump(do)
-				if err != nil {
-					os.Remove(do.WriteToFile)
-					return fmt.Errorf("problem collecting Active Directory Forest DNS objects: %v", err)
-				}
+				return fmt.Errorf("problem collecting Active Directory Forest DNS objects: %v", err)
 			}
 		}
+	}
 
-		cs, _ = util.ParseBool(*collectobjects)
-		if (*collectobjects == "auto" && domainContext != "") || cs {
-			log.Info().Msg("Collecting main AD objects ...")
-			do.SearchBase = domainContext
-			do.WriteToFile = filepath.Join(datapath, do.SearchBase+".objects.msgp.lz4")
+	cs, _ = util.ParseBool(*collectobjects)
+	if (*collectobjects == "auto" && domainContext != "") || cs {
+		log.Info().Msg("Collecting main AD objects ...")
+		do.SearchBase = domainContext
+		do.WriteToFile = filepath.Join(datapath, do.SearchBase+".objects.msgp.lz4")
 
-			cp, _ := util.ParseBool(*collectgpos)
-			if *collectgpos == "auto" || cp {
-				do.OnObject = func(ro *activedirectory.RawObject) error {
-					if _, found := ro.Attributes["gPCFileSysPath"]; found {
-						gpostocollect = append(gpostocollect, ro)
-					}
-					return nil
-				}
-			}
+		do.OnObject = func(ro *activedirectory.RawObject) error {
+			onobject(ro)
+			return nil
+		}
 
-			_, err = ad.Dump(do)
-			if err != nil {
-				os.Remove(do.WriteToFile)
-				return fmt.Errorf("problem collecting Active Directory objects: %v", err)
-			}
+		// Constructed attributes are only returned when asked for explicitly. The RODC revealed list only exists
+		// on RODC computer objects, so asking for it on everything costs nothing for other objects
+		constructed := []string{"msDS-RevealedList"}
+		if *replmetadata {
+			constructed = append(constructed, "msDS-ReplAttributeMetaData", "msDS-ReplValueMetaData")
 		}
+		if len(do.Attributes) == 0 {
+			do.Attributes = []string{"*"}
+		}
+		do.Attributes = append(do.Attributes, constructed...)
 
-		err = ad.Disconnect()
+		_, err = ad.Dump(do)
 		if err != nil {
-			return fmt.Errorf("problem disconnecting from AD: %v", err)
+			os.Remove(do.WriteToFile)
+			return fmt.Errorf("problem collecting Active Directory objects: %v", err)
 		}
 	}
 
-	cp, _ := util.ParseBool(*collectgpos)
-	if *collectgpos == "auto" || cp {
-		log.Debug().Msg("Collecting GPO files ...")
-		if *gpopath != "" {
-			log.Warn().Msg("Disabling GPO file ACL detection on overridden GPO path")
-		}
-		for _, object := range gpostocollect {
-			// Let's check if it this is a GPO and then add som fake attributes to represent it
-			if gpfsp, found := object.Attributes["gPCFileSysPath"]; found {
+	err = ad.Disconnect()
+	if err != nil {
+		return fmt.Errorf("problem disconnecting from AD: %v", err)
+	}
 
-				domainPart := util.ExtractDomainPart(object.DistinguishedName)
+	return nil
+}
 
-				gpodisplayname := object.Attributes["displayName"]
-				gpoguid := object.Attributes["name"]
-				originalpath := gpfsp[0]
+// collectGPOFiles saves the contents of the GPO folders for the GPO objects in datapath
+func collectGPOFiles(datapath string, gpostocollect []*activedirectory.RawObject) {
+	log.Debug().Msg("Collecting GPO files ...")
+	if *gpopath != "" {
+		log.Warn().Msg("Disabling GPO file ACL detection on overridden GPO path")
+	}
+	for _, object := range gpostocollect {
+		// Let's check if it this is a GPO and then add som fake attributes to represent it
+		if gpfsp, found := object.Attributes["gPCFileSysPath"]; found {
 
-				gppath := originalpath
-				if *gpopath != "" {
-					if len(gpoguid) != 1 {
-						log.Warn().Msgf("GPO %v GUID not readable, skipping", gpodisplayname)
-						continue
-					}
+			domainPart := util.ExtractDomainPart(object.DistinguishedName)
+
+			gpodisplayname := object.Attributes["displayName"]
+			gpoguid := object.Attributes["name"]
+			originalpath := gpfsp[0]
 
-					gppath = filepath.Join(*gpopath, gpoguid[0])
+			gppath := originalpath
+			if *gpopath != "" {
+				if len(gpoguid) != 1 {
+					log.Warn().Msgf("GPO %v GUID not readable, skipping", gpodisplayname)
+					continue
 				}
-				log.Info().Msgf("Collecting group policy files from %v ...", gppath)
 
-				_, err := os.Stat(gppath)
-				if err != nil {
-					log.Warn().Msg("Can't access path, aborting this GPO ...")
-				} else {
-					gpoinfo := activedirectory.GPOdump{
-						Common: basedata.GetCommonData(),
-					}
+				gppath = filepath.Join(*gpopath, gpoguid[0])
+			}
+			log.Info().Msgf("Collecting group policy files from %v ...", gppath)
+
+			_, err := os.Stat(gppath)
+			if err != nil {
+				log.Warn().Msg("Can't access path, aborting this GPO ...")
+			} else {
+				gpoinfo := activedirectory.GPOdump{
+					Common: basedata.GetCommonData(),
+				}
 
-					gpuuid, _ := uuid.FromString(gpoguid[0])
+				gpuuid, _ := uuid.FromString(gpoguid[0])
 
-					gpoinfo.GPOinfo.GUID = gpuuid
-					gpoinfo.GPOinfo.Path = originalpath // The original path is kept, we don't care
-					gpoinfo.GPOinfo.DomainDN = domainPart
+				gpoinfo.GPOinfo.GUID = gpuuid
+				gpoinfo.GPOinfo.Path = originalpath // The original path is kept, we don't care
+				gpoinfo.GPOinfo.DomainDN = domainPart
 
-					offset := len(gppath)
-					var filescollected int
-					filepath.WalkDir(gppath, func(curpath string, d fs.DirEntry, err error) error {
-						if !d.IsDir() &&
-							(strings.HasSuffix(strings.ToLower(curpath), ".adm") || strings.HasSuffix(strings.ToLower(curpath), ".admx")) {
-							// Skip .adm(x) files that slipped in here
-							return nil
-						}
+				offset := len(gppath)
+				var filescollected int
+				filepath.WalkDir(gppath, func(curpath string, d fs.DirEntry, err error) error {
+					if !d.IsDir() &&
+						(strings.HasSuffix(strings.ToLower(curpath), ".adm") || strings.HasSuffix(strings.ToLower(curpath), ".admx")) {
+						// Skip .adm(x) files that slipped in here
+						return nil
+					}
 
-						var fileinfo activedirectory.GPOfileinfo
-						fileinfo.IsDir = d.IsDir()
-						if !fileinfo.IsDir {
-							if info, err := d.Info(); err == nil {
-								fileinfo.Timestamp = info.ModTime()
-								fileinfo.Size = info.Size()
-							}
+					var fileinfo activedirectory.GPOfileinfo
+					fileinfo.IsDir = d.IsDir()
+					if !fileinfo.IsDir {
+						if info, err := d.Info(); err == nil {
+							fileinfo.Timestamp = info.ModTime()
+							fileinfo.Size = info.Size()
 						}
-						fileinfo.RelativePath = curpath[offset:]
-
-						if gppath == originalpath {
-							// Do file ACL analysis if we're reading directly from SYSVOL
-							owner, dacl, err := windowssecurity.GetOwnerAndDACL(curpath, windowssecurity.SE_FILE_OBJECT)
-							if err == nil {
-								fileinfo.OwnerSID = owner
-								fileinfo.DACL = dacl
-							} else {
-								log.Warn().Msgf("Problem getting %v DACL: %v", curpath, err)
-							}
+					}
+					fileinfo.RelativePath = curpath[offset:]
+
+					if gppath == originalpath {
+						// Do file ACL analysis if we're reading directly from SYSVOL
+						owner, dacl, err := windowssecurity.GetOwnerAndDACL(curpath, windowssecurity.SE_FILE_OBJECT)
+						if err == nil {
+							fileinfo.OwnerSID = owner
+							fileinfo.DACL = dacl
+						} else {
+							log.Warn().Msgf("Problem getting %v DACL: %v", curpath, err)
 						}
-						if !d.IsDir() {
-							filescollected++
-
-							rawfile, err := ioutil.ReadFile(curpath)
-							if err == nil {
-								fileinfo.Contents = rawfile
-							} else {
-								log.Warn().Msgf("Problem getting %v contents: %v", curpath, err)
-							}
+					}
+					if !d.IsDir() {
+						filescollected++
+
+						rawfile, err := ioutil.ReadFile(curpath)
+						if err == nil {
+							fileinfo.Contents = rawfile
+						} else {
+							log.Warn().Msgf("Problem getting %v contents: %v", curpath, err)
 						}
-						gpoinfo.GPOinfo.Files = append(gpoinfo.GPOinfo.Files, fileinfo)
-						return nil
-					})
-
-					if filescollected == 0 {
-						log.Warn().Msgf("No files found/accessible in %v", gppath)
 					}
+					gpoinfo.GPOinfo.Files = append(gpoinfo.GPOinfo.Files, fileinfo)
+					return nil
+				})
 
-					gpodatafile := filepath.Join(datapath, gpoguid[0]+".gpodata.json")
-					f, err := os.Create(gpodatafile)
-					if err != nil {
-						log.Error().Msgf("Problem writing GPO information to %v: %v")
-					}
-					defer f.Close()
+				if filescollected == 0 {
+					log.Warn().Msgf("No files found/accessible in %v", gppath)
+				}
 
-					encoder := json.NewEncoder(f)
-					encoder.SetIndent("", "  ")
-					err = encoder.Encode(gpoinfo)
-					if err != nil {
-						log.Error().Msgf("Problem marshalling GPO information to %v: %v", gpodatafile, err)
-					}
+				gpodatafile := filepath.Join(datapath, gpoguid[0]+".gpodata.json")
+				f, err := os.Create(gpodatafile)
+				if err != nil {
+					log.Error().Msgf("Problem writing GPO information to %v: %v", gpodatafile, err)
+					continue
+				}
+				defer f.Close()
+
+				encoder := json.NewEncoder(f)
+				encoder.SetIndent("", "  ")
+				err = encoder.Encode(gpoinfo)
+				if err != nil {
+					log.Error().Msgf("Problem marshalling GPO information to %v: %v", gpodatafile, err)
 				}
-			} else {
-				log.Warn().Msgf("Skipping %v, not a GPO", object.Attributes["displayName"])
 			}
+		} else {
+			log.Warn().Msgf("Skipping %v, not a GPO", object.Attributes["displayName"])
 		}
 	}
+}
 
-	return nil
+// createObjectsFile opens a compressed file for RawObjects, call the returned function to flush and close it
+func createObjectsFile(path string) (*msgp.Writer, func() error, error) {
+	outfile, err := os.Create(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("problem opening domain cache file: %v", err)
+	}
+
+	boutfile := lz4.NewWriter(outfile)
+	lz4options := []lz4.Option{
+		lz4.BlockChecksumOption(true),
+		// lz4.BlockSizeOption(lz4.BlockSize(51 * 1024)),
+		lz4.ChecksumOption(true),
+		lz4.CompressionLevelOption(lz4.Level9),
+		lz4.ConcurrencyOption(-1),
+	}
+	boutfile.Apply(lz4options...)
+	e := msgp.NewWriter(boutfile)
+
+	return e, func() error {
+		err := e.Flush()
+		if err == nil {
+			err = boutfile.Close()
+		}
+		if cerr := outfile.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	}, nil
 }
@@ -0,0 +1,274 @@
+package collect
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/lkarlslund/adalanche/modules/basedata"
+	"github.com/lkarlslund/adalanche/modules/integrations/activedirectory"
+	"github.com/lkarlslund/adalanche/modules/util"
+	"github.com/lkarlslund/adalanche/modules/windowssecurity"
+	ldap "github.com/lkarlslund/ldap/v3"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// dumpForest discovers all domains in the forest from the first DC, and collects each of them into a subfolder
+func dumpForest(options LDAPOptions, datapath string) error {
+	manifest, err := discoverForest(options)
+	if err != nil {
+		return err
+	}
+
+	concurrency := *forestconcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	cp, _ := util.ParseBool(*collectgpos)
+
+	var wg sync.WaitGroup
+	queue := make(chan int, len(manifest.Domains))
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			for i := range queue {
+				fd := &manifest.Domains[i]
+				if fd.Server == "" {
+					continue
+				}
+
+				domainpath := filepath.Join(datapath, fd.Path)
+				err := os.MkdirAll(domainpath, 0755)
+				if err == nil {
+					log.Info().Msgf("Collecting domain %v from %v ...", fd.DNSRoot, fd.Server)
+
+					domainoptions := options
+					domainoptions.Domain = fd.DNSRoot
+					domainoptions.Server = fd.Server
+
+					var gpostocollect []*activedirectory.RawObject
+					err = dumpDomain(domainoptions, domainpath, func(ro *activedirectory.RawObject) {
+						if *collectgpos == "auto" || cp {
+							if _, found := ro.Attributes["gPCFileSysPath"]; found {
+								gpostocollect = append(gpostocollect, ro)
+							}
+						}
+					})
+					if err == nil && (*collectgpos == "auto" || cp) {
+						collectGPOFiles(domainpath, gpostocollect)
+					}
+				}
+				if err != nil {
+					log.Error().Msgf("Problem collecting domain %v: %v", fd.DNSRoot, err)
+					fd.Error = err.Error()
+				}
+			}
+			wg.Done()
+		}()
+	}
+	for i := range manifest.Domains {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+
+	manifestfile := filepath.Join(datapath, manifest.RootDomain+".forest.json")
+	f, err := os.Create(manifestfile)
+	if err != nil {
+		return fmt.Errorf("problem writing forest manifest to %v: %v", manifestfile, err)
+	}
+	defer f.Close()
+
+	encoder := json.NewEncoder(f)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(manifest)
+	if err != nil {
+		return fmt.Errorf("problem marshalling forest manifest to %v: %v", manifestfile, err)
+	}
+
+	var failed int
+	for _, fd := range manifest.Domains {
+		if fd.Error != "" {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%v of %v domains in the forest could not be collected", failed, len(manifest.Domains))
+	}
+	return nil
+}
+
+// discoverForest reads the partitions from the first DC, finds a DC for each domain and reads the trusts of every domain
+func discoverForest(options LDAPOptions) (activedirectory.ForestManifest, error) {
+	manifest := activedirectory.ForestManifest{
+		Common: basedata.GetCommonData(),
+	}
+
+	ad := CreateDumper(options)
+	err := ad.Connect()
+	if err != nil {
+		return manifest, errors.Wrap(err, "problem connecting to AD")
+	}
+	defer ad.Disconnect()
+
+	log.Info().Msg("Probing RootDSE ...")
+	rootdse, err := ad.Dump(DumpOptions{
+		SearchBase:    "",
+		Query:         "(objectClass=*)",
+		Scope:         ldap.ScopeBaseObject,
+		ReturnObjects: true,
+	})
+	if err != nil {
+		return manifest, fmt.Errorf("problem querying Active Directory RootDSE: %w", err)
+	}
+	if len(rootdse) != 1 {
+		return manifest, fmt.Errorf("expected 1 Active Directory RootDSE object, but got %v", len(rootdse))
+	}
+	rd := rootdse[0]
+
+	var domainContext string
+	if len(rd.Attributes["defaultNamingContext"]) > 0 {
+		domainContext = rd.Attributes["defaultNamingContext"][0]
+	}
+	if len(rd.Attributes["rootDomainNamingContext"]) > 0 {
+		manifest.RootDomain = rd.Attributes["rootDomainNamingContext"][0]
+	}
+	if len(rd.Attributes["configurationNamingContext"]) > 0 {
+		manifest.Configuration = rd.Attributes["configurationNamingContext"][0]
+	}
+	if manifest.Configuration == "" || domainContext == "" {
+		return manifest, errors.New("RootDSE does not contain the configuration and domain naming contexts")
+	}
+
+	log.Info().Msg("Discovering domains in forest ...")
+	crossrefs, err := ad.Dump(DumpOptions{
+		SearchBase:    "CN=Partitions," + manifest.Configuration,
+		Query:         "(&(objectClass=crossRef)(systemFlags:1.2.840.113556.1.4.803:=2))", // FLAG_CR_NTDS_DOMAIN
+		Scope:         ldap.ScopeSingleLevel,
+		Attributes:    []string{"nCName", "dnsRoot", "nETBIOSName"},
+		ReturnObjects: true,
+	})
+	if err != nil {
+		return manifest, fmt.Errorf("problem querying forest partitions: %w", err)
+	}
+
+	for _, crossref := range crossrefs {
+		if len(crossref.Attributes["nCName"]) == 0 || len(crossref.Attributes["dnsRoot"]) == 0 {
+			continue
+		}
+		fd := activedirectory.ForestDomain{
+			DistinguishedName: crossref.Attributes["nCName"][0],
+			DNSRoot:           strings.ToLower(crossref.Attributes["dnsRoot"][0]),
+		}
+		if len(crossref.Attributes["nETBIOSName"]) > 0 {
+			fd.NetBIOSName = crossref.Attributes["nETBIOSName"][0]
+		}
+		fd.Path = fd.DNSRoot
+
+		if strings.EqualFold(fd.DistinguishedName, domainContext) {
+			// Reuse the DC we're already talking to
+			fd.Server = options.Server
+		} else {
+			_, servers, err := net.LookupSRV("", "", "_ldap._tcp.dc._msdcs."+fd.DNSRoot)
+			if err == nil && len(servers) > 0 {
+				fd.Server = strings.TrimRight(servers[0].Target, ".")
+			} else {
+				if err == nil {
+					log.Warn().Msgf("Could not find a DC for domain %v via DNS: no SRV records returned", fd.DNSRoot)
+				} else {
+					log.Warn().Msgf("Could not find a DC for domain %v via DNS: %v", fd.DNSRoot, err)
+				}
+				fd.Error = "DC auto-detection failed"
+			}
+		}
+		log.Info().Msgf("Found domain %v (%v), using DC %v", fd.DNSRoot, fd.NetBIOSName, fd.Server)
+		manifest.Domains = append(manifest.Domains, fd)
+	}
+
+	log.Info().Msg("Discovering trusts ...")
+	for _, fd := range manifest.Domains {
+		if strings.EqualFold(fd.DistinguishedName, domainContext) {
+			trusts, err := discoverTrusts(ad, fd.DistinguishedName)
+			if err != nil {
+				return manifest, err
+			}
+			manifest.Trusts = append(manifest.Trusts, trusts...)
+			continue
+		}
+		if fd.Server == "" {
+			log.Warn().Msgf("No DC for domain %v, trusts from this domain are not collected", fd.DNSRoot)
+			continue
+		}
+
+		// Each domain keeps its own trustedDomain objects, so ask one of its DCs
+		domainoptions := options
+		domainoptions.Domain = fd.DNSRoot
+		domainoptions.Server = fd.Server
+		domainad := CreateDumper(domainoptions)
+		err = domainad.Connect()
+		if err != nil {
+			log.Warn().Msgf("Problem connecting to %v for domain %v, trusts from this domain are not collected: %v", fd.Server, fd.DNSRoot, err)
+			continue
+		}
+		trusts, err := discoverTrusts(domainad, fd.DistinguishedName)
+		domainad.Disconnect()
+		if err != nil {
+			log.Warn().Msgf("Trusts from domain %v are not collected: %v", fd.DNSRoot, err)
+			continue
+		}
+		manifest.Trusts = append(manifest.Trusts, trusts...)
+	}
+
+	return manifest, nil
+}
+
+// discoverTrusts reads the trustedDomain objects in the System container of a domain
+func discoverTrusts(ad LDAPDumper, domainContext string) ([]activedirectory.ForestTrust, error) {
+	var results []activedirectory.ForestTrust
+	trusts, err := ad.Dump(DumpOptions{
+		SearchBase:    "CN=System," + domainContext,
+		Query:         "(objectClass=trustedDomain)",
+		Scope:         ldap.ScopeSingleLevel,
+		Attributes:    []string{"trustPartner", "flatName", "securityIdentifier", "trustDirection", "trustType", "trustAttributes"},
+		ReturnObjects: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("problem querying trusts in %v: %w", domainContext, err)
+	}
+
+	for _, trust := range trusts {
+		ft := activedirectory.ForestTrust{
+			Domain: domainContext,
+		}
+		if v := trust.Attributes["trustPartner"]; len(v) > 0 {
+			ft.TrustPartner = v[0]
+		}
+		if v := trust.Attributes["flatName"]; len(v) > 0 {
+			ft.FlatName = v[0]
+		}
+		if v := trust.Attributes["securityIdentifier"]; len(v) > 0 {
+			if sid, _, err := windowssecurity.ParseSID([]byte(v[0])); err == nil {
+				ft.SID = sid.String()
+			}
+		}
+		if v := trust.Attributes["trustDirection"]; len(v) > 0 {
+			ft.TrustDirection, _ = strconv.Atoi(v[0])
+		}
+		if v := trust.Attributes["trustType"]; len(v) > 0 {
+			ft.TrustType, _ = strconv.Atoi(v[0])
+		}
+		if v := trust.Attributes["trustAttributes"]; len(v) > 0 {
+			ft.TrustAttributes, _ = strconv.Atoi(v[0])
+		}
+		log.Info().Msgf("Found trust from %v with %v (direction %v, type %v, attributes %x)", domainContext, ft.TrustPartner, ft.TrustDirection, ft.TrustType, ft.TrustAttributes)
+		results = append(results, ft)
+	}
+	return results, nil
+}
@@ -0,0 +1,604 @@
+package collect
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lkarlslund/adalanche/modules/ese"
+	"github.com/lkarlslund/adalanche/modules/integrations/activedirectory"
+	"github.com/rs/zerolog/log"
+	"github.com/schollz/progressbar/v3"
+)
+
+// Column names of attributes needed to bootstrap the schema from the NTDS datatable
+// Attribute columns are named ATT + syntax letter + attribute ID
+const (
+	ntdsObjectClass     = "ATTc0"
+	ntdsName            = "ATTm589825"
+	ntdsInstanceType    = "ATTj131073"
+	ntdsAttributeID     = "ATTc131102"
+	ntdsAttributeSyntax = "ATTc131104"
+	ntdsGovernsID       = "ATTc131094"
+	ntdsLDAPDisplayName = "ATTm131532"
+	ntdsIntID           = "ATTj591540"
+	ntdsLinkID          = "ATTj131122"
+)
+
+// Secrets are never returned by LDAP, so we don't put them in the dump either
+var ntdsSkipAttributes = map[string]struct{}{
+	"unicodePwd":              {},
+	"dBCSPwd":                 {},
+	"ntPwdHistory":            {},
+	"lmPwdHistory":            {},
+	"supplementalCredentials": {},
+	"pekList":                 {},
+	"currentValue":            {},
+	"priorValue":              {},
+	"trustAuthIncoming":       {},
+	"trustAuthOutgoing":       {},
+	"initialAuthIncoming":     {},
+	"initialAuthOutgoing":     {},
+}
+
+// dstimeEpochOffset is the number of seconds between 1601-01-01 and the Unix epoch
+const dstimeEpochOffset = 11644473600
+
+type ntdsObject struct {
+	parent  int32
+	nc      int32
+	rdntype uint32
+	rdn     string
+	object  bool
+}
+
+type ntdsColumn struct {
+	column *ese.Column
+	name   string
+	syntax byte
+}
+
+type ntdsLink struct {
+	attribute string
+	target    int32
+	data      []byte
+}
+
+type ntdsDumper struct {
+	db        *ese.Database
+	datatable *ese.Table
+
+	dnt, pdnt, ncdnt, rdntyp, obj *ese.Column
+	isdeleted, isrecycled         *ese.Column
+
+	objects    map[int32]*ntdsObject
+	dns        map[int32]string
+	attributes map[uint32]string
+	syntaxes   map[string]byte
+	classes    map[uint32]string
+	linkids    map[int32]string
+
+	columns []ntdsColumn
+	sds     map[int64][]byte
+	links   map[int32][]ntdsLink
+
+	dsa      int32
+	ncheads  map[int32]ese.Record
+	includes map[int32]struct{}
+}
+
+// DumpFromNTDS reads an offline copy of NTDS.dit, and calls the callback with the same objects an LDAP dump would return
+func DumpFromNTDS(path string, onobject func(ro *activedirectory.RawObject) error) error {
+	db, err := ese.Open(path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if db.State() != ese.STATE_CLEAN_SHUTDOWN {
+		log.Warn().Msgf("NTDS database %v was not shut down cleanly (state %v), consider recovering it with esentutl /r before importing", path, db.State())
+	}
+
+	d := ntdsDumper{
+		db:         db,
+		objects:    make(map[int32]*ntdsObject),
+		dns:        make(map[int32]string),
+		attributes: make(map[uint32]string),
+		syntaxes:   make(map[string]byte),
+		classes:    make(map[uint32]string),
+		linkids:    make(map[int32]string),
+		sds:        make(map[int64][]byte),
+		links:      make(map[int32][]ntdsLink),
+		ncheads:    make(map[int32]ese.Record),
+	}
+
+	var found bool
+	d.datatable, found = db.Table("datatable")
+	if !found {
+		return fmt.Errorf("%v does not contain a datatable, is this an NTDS database?", path)
+	}
+
+	d.dnt = d.datatable.ColumnByName("DNT_col")
+	d.pdnt = d.datatable.ColumnByName("PDNT_col")
+	d.ncdnt = d.datatable.ColumnByName("NCDNT_col")
+	d.rdntyp = d.datatable.ColumnByName("RDNtyp_col")
+	d.obj = d.datatable.ColumnByName("OBJ_col")
+	if d.dnt == nil || d.pdnt == nil || d.rdntyp == nil || d.obj == nil {
+		return fmt.Errorf("datatable in %v is missing required columns", path)
+	}
+
+	d.dsa = -1
+	if hiddentable, found := db.Table("hiddentable"); found {
+		dsacol := hiddentable.ColumnByName("dsa_col")
+		hiddentable.Walk(func(r ese.Record) error {
+			if dsa, ok := r.Int32(dsacol); ok {
+				d.dsa = dsa
+			}
+			return nil
+		})
+	}
+
+	log.Info().Msg("Reading NTDS schema and object hierarchy ...")
+	var dsarecord ese.Record
+	err = d.scanObjects(func(dnt int32, r ese.Record) {
+		if dnt == d.dsa {
+			dsarecord = r
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("problem reading NTDS datatable: %v", err)
+	}
+	d.mapColumns()
+
+	log.Info().Msg("Reading NTDS security descriptors ...")
+	err = d.readSecurityDescriptors()
+	if err != nil {
+		return fmt.Errorf("problem reading NTDS sd_table: %v", err)
+	}
+
+	log.Info().Msg("Reading NTDS linked attributes ...")
+	err = d.readLinks()
+	if err != nil {
+		return fmt.Errorf("problem reading NTDS link_table: %v", err)
+	}
+
+	rootdse := d.rootDSE(dsarecord)
+	err = onobject(&rootdse)
+	if err != nil {
+		return err
+	}
+
+	var total int
+	for _, o := range d.objects {
+		if o.object {
+			total++
+		}
+	}
+
+	bar := progressbar.NewOptions(total,
+		progressbar.OptionSetDescription("Dumping from "+path+" ..."),
+		progressbar.OptionShowCount(),
+		progressbar.OptionShowIts(),
+		progressbar.OptionSetItsString("objects"),
+		progressbar.OptionOnCompletion(func() { fmt.Println() }),
+		progressbar.OptionThrottle(time.Second*1),
+	)
+
+	err = d.datatable.Walk(func(r ese.Record) error {
+		dnt, _ := r.Int32(d.dnt)
+		o := d.objects[dnt]
+		if o == nil || !o.object {
+			return nil
+		}
+		bar.Add(1)
+		if d.deleted(r) {
+			return nil
+		}
+		if d.includes != nil {
+			if _, found := d.includes[o.nc]; !found {
+				if _, found := d.includes[dnt]; !found {
+					return nil
+				}
+			}
+		}
+
+		ro, ok := d.rawObject(dnt, r)
+		if !ok {
+			return nil
+		}
+		return onobject(&ro)
+	})
+	bar.Finish()
+	if err != nil {
+		return fmt.Errorf("problem dumping NTDS objects: %v", err)
+	}
+
+	return nil
+}
+
+// scanObjects builds the object hierarchy and schema lookup tables needed to decode everything else
+func (d *ntdsDumper) scanObjects(cb func(dnt int32, r ese.Record)) error {
+	objectclass := d.datatable.ColumnByName(ntdsObjectClass)
+	name := d.datatable.ColumnByName(ntdsName)
+	instancetype := d.datatable.ColumnByName(ntdsInstanceType)
+	attributeid := d.datatable.ColumnByName(ntdsAttributeID)
+	attributesyntax := d.datatable.ColumnByName(ntdsAttributeSyntax)
+	governsid := d.datatable.ColumnByName(ntdsGovernsID)
+	ldapdisplayname := d.datatable.ColumnByName(ntdsLDAPDisplayName)
+	intid := d.datatable.ColumnByName(ntdsIntID)
+	linkid := d.datatable.ColumnByName(ntdsLinkID)
+
+	if objectclass == nil || name == nil || attributeid == nil || governsid == nil || ldapdisplayname == nil {
+		return fmt.Errorf("datatable is missing required schema columns")
+	}
+
+	return d.datatable.Walk(func(r ese.Record) error {
+		dnt, ok := r.Int32(d.dnt)
+		if !ok {
+			return nil
+		}
+		parent, _ := r.Int32(d.pdnt)
+		nc, _ := r.Int32(d.ncdnt)
+		rdntype, _ := r.Int32(d.rdntyp)
+
+		d.objects[dnt] = &ntdsObject{
+			parent:  parent,
+			nc:      nc,
+			rdntype: uint32(rdntype),
+			rdn:     ese.DecodeUnicode(r.Bytes(name)),
+			object:  r.Bool(d.obj) && len(r[objectclass.ID]) > 0,
+		}
+
+		if it, ok := r.Int32(instancetype); ok && it&1 != 0 && d.objects[dnt].object {
+			d.ncheads[dnt] = r
+		}
+
+		if displayname := r.Bytes(ldapdisplayname); displayname != nil {
+			ldapname := ese.DecodeUnicode(displayname)
+			if id, ok := r.Int32(attributeid); ok {
+				d.attributes[uint32(id)] = ldapname
+				if iid, ok := r.Int32(intid); ok {
+					d.attributes[uint32(iid)] = ldapname
+				}
+				if lid, ok := r.Int32(linkid); ok {
+					d.linkids[lid] = ldapname
+				}
+				if syntax, ok := r.Int32(attributesyntax); ok && syntax>>16 == 0x0008 {
+					// 2.5.5.x is encoded with prefix 0x0008, and maps to letters in the column names
+					d.syntaxes[ldapname] = byte('a' + syntax&0xffff)
+				}
+			}
+			if id, ok := r.Int32(governsid); ok {
+				d.classes[uint32(id)] = ldapname
+			}
+		}
+
+		cb(dnt, r)
+		return nil
+	})
+}
+
+// mapColumns finds all attribute columns in the datatable and resolves their LDAP names
+func (d *ntdsDumper) mapColumns() {
+	for _, c := range d.datatable.Columns {
+		if len(c.Name) < 5 || !strings.HasPrefix(c.Name, "ATT") {
+			continue
+		}
+		id, err := strconv.ParseUint(c.Name[4:], 10, 32)
+		if err != nil {
+			continue
+		}
+		name, found := d.attributes[uint32(id)]
+		if !found {
+			log.Debug().Msgf("NTDS column %v not found in schema, skipping", c.Name)
+			continue
+		}
+		switch name {
+		case "isDeleted":
+			d.isdeleted = c
+		case "isRecycled":
+			d.isrecycled = c
+		}
+		if _, skip := ntdsSkipAttributes[name]; skip {
+			continue
+		}
+		d.columns = append(d.columns, ntdsColumn{
+			column: c,
+			name:   name,
+			syntax: c.Name[3],
+		})
+	}
+}
+
+func (d *ntdsDumper) readSecurityDescriptors() error {
+	sdtable, found := d.db.Table("sd_table")
+	if !found {
+		// Windows 2000 stores security descriptors directly in the datatable
+		return nil
+	}
+	sdid := sdtable.ColumnByName("sd_id")
+	sdvalue := sdtable.ColumnByName("sd_value")
+	if sdid == nil || sdvalue == nil {
+		return fmt.Errorf("sd_table is missing required columns")
+	}
+	return sdtable.Walk(func(r ese.Record) error {
+		if id, ok := r.Int64(sdid); ok {
+			d.sds[id] = r.Bytes(sdvalue)
+		}
+		return nil
+	})
+}
+
+func (d *ntdsDumper) readLinks() error {
+	linktable, found := d.db.Table("link_table")
+	if !found {
+		return fmt.Errorf("link_table not found")
+	}
+	linkdnt := linktable.ColumnByName("link_DNT")
+	backlinkdnt := linktable.ColumnByName("backlink_DNT")
+	linkbase := linktable.ColumnByName("link_base")
+	linkdeltime := linktable.ColumnByName("link_deltime")
+	linkdata := linktable.ColumnByName("link_data")
+	if linkdnt == nil || backlinkdnt == nil || linkbase == nil {
+		return fmt.Errorf("link_table is missing required columns")
+	}
+
+	return linktable.Walk(func(r ese.Record) error {
+		if linkdeltime != nil && r.Bytes(linkdeltime) != nil {
+			// Absent (deleted) linked value
+			return nil
+		}
+		source, ok := r.Int32(linkdnt)
+		if !ok {
+			return nil
+		}
+		target, ok := r.Int32(backlinkdnt)
+		if !ok {
+			return nil
+		}
+		base, _ := r.Int32(linkbase)
+		d.addLink(source, target, base, r.Bytes(linkdata))
+		return nil
+	})
+}
+
+// addLink records a link table row on the source (forward link) and the target (backlink)
+func (d *ntdsDumper) addLink(source, target, base int32, data []byte) {
+	if forward, found := d.linkids[base*2]; found {
+		d.links[source] = append(d.links[source], ntdsLink{
+			attribute: forward,
+			target:    target,
+			data:      data,
+		})
+	}
+	if backward, found := d.linkids[base*2+1]; found {
+		d.links[target] = append(d.links[target], ntdsLink{
+			attribute: backward,
+			target:    source,
+		})
+	}
+}
+
+// deleted returns true for tombstones and recycled objects, which keep their SIDs, but LDAP doesn't return
+// them without the show deleted control
+func (d *ntdsDumper) deleted(r ese.Record) bool {
+	return r.Bool(d.isdeleted) || r.Bool(d.isrecycled)
+}
+
+// rootDSE synthesizes the RootDSE from the naming contexts this DC holds
+func (d *ntdsDumper) rootDSE(dsarecord ese.Record) activedirectory.RawObject {
+	var rootdse activedirectory.RawObject
+	rootdse.Init()
+
+	if dsarecord != nil {
+		d.includes = make(map[int32]struct{})
+		for _, attribute := range []string{"hasMasterNCs", "msDS-hasMasterNCs", "msDS-hasFullReplicaNCs"} {
+			for _, c := range d.columns {
+				if c.name == attribute {
+					for _, value := range dsarecord[c.column.ID] {
+						if len(value) >= 4 {
+							d.includes[int32(binary.LittleEndian.Uint32(value))] = struct{}{}
+						}
+					}
+				}
+			}
+		}
+		if len(d.includes) == 0 {
+			d.includes = nil
+		} else {
+			rootdse.Attributes["dsServiceName"] = []string{d.dn(d.dsa)}
+		}
+	}
+	if d.includes == nil {
+		log.Warn().Msg("Could not determine naming contexts held by this DC, dumping all objects in database")
+	}
+
+	objectclass := d.datatable.ColumnByName(ntdsObjectClass)
+	for dnt, r := range d.ncheads {
+		if d.includes != nil {
+			if _, found := d.includes[dnt]; !found {
+				continue
+			}
+		}
+		dn := d.dn(dnt)
+		rootdse.Attributes["namingContexts"] = append(rootdse.Attributes["namingContexts"], dn)
+		for _, class := range r[objectclass.ID] {
+			if len(class) < 4 {
+				continue
+			}
+			switch d.classes[binary.LittleEndian.Uint32(class)] {
+			case "domainDNS":
+				rootdse.Attributes["defaultNamingContext"] = []string{dn}
+			case "configuration":
+				rootdse.Attributes["configurationNamingContext"] = []string{dn}
+				rootdse.Attributes["rootDomainNamingContext"] = []string{strings.TrimPrefix(dn, "CN=Configuration,")}
+			case "dMD":
+				rootdse.Attributes["schemaNamingContext"] = []string{dn}
+			}
+		}
+	}
+	return rootdse
+}
+
+func (d *ntdsDumper) rawObject(dnt int32, r ese.Record) (activedirectory.RawObject, bool) {
+	var ro activedirectory.RawObject
+	ro.Init()
+	ro.DistinguishedName = d.dn(dnt)
+	if ro.DistinguishedName == "" {
+		return ro, false
+	}
+	ro.Attributes["distinguishedName"] = []string{ro.DistinguishedName}
+
+	for _, c := range d.columns {
+		rawvalues, found := r[c.column.ID]
+		if !found {
+			continue
+		}
+		values := make([]string, 0, len(rawvalues))
+		for _, rawvalue := range rawvalues {
+			if value, ok := d.decode(c.syntax, rawvalue); ok {
+				values = append(values, value)
+			}
+		}
+		if len(values) > 0 {
+			ro.Attributes[c.name] = values
+		}
+	}
+
+	for _, link := range d.links[dnt] {
+		target := d.dn(link.target)
+		if target == "" {
+			continue
+		}
+		if link.data != nil && d.syntaxes[link.attribute] == 'h' {
+			// DN-Binary
+			target = fmt.Sprintf("B:%d:%X:%s", len(link.data)*2, link.data, target)
+		}
+		ro.Attributes[link.attribute] = append(ro.Attributes[link.attribute], target)
+	}
+
+	return ro, true
+}
+
+// decode converts the database representation of a value into what LDAP would return
+func (d *ntdsDumper) decode(syntax byte, value []byte) (string, bool) {
+	switch syntax {
+	case 'b': // DN
+		if len(value) < 4 {
+			return "", false
+		}
+		dn := d.dn(int32(binary.LittleEndian.Uint32(value)))
+		return dn, dn != ""
+	case 'c': // OID
+		if len(value) < 4 {
+			return "", false
+		}
+		id := binary.LittleEndian.Uint32(value)
+		if name, found := d.classes[id]; found {
+			return name, true
+		}
+		if name, found := d.attributes[id]; found {
+			return name, true
+		}
+		return strconv.FormatUint(uint64(id), 10), true
+	case 'd', 'e', 'f', 'g', 'k': // Strings in various charsets and octet strings
+		return string(value), true
+	case 'i': // Boolean
+		if len(value) < 4 {
+			return "", false
+		}
+		if binary.LittleEndian.Uint32(value) != 0 {
+			return "TRUE", true
+		}
+		return "FALSE", true
+	case 'j': // Integer
+		if len(value) < 4 {
+			return "", false
+		}
+		return strconv.FormatInt(int64(int32(binary.LittleEndian.Uint32(value))), 10), true
+	case 'l': // Time, stored as seconds since 1601
+		if len(value) < 8 {
+			return "", false
+		}
+		seconds := int64(binary.LittleEndian.Uint64(value))
+		if seconds == 0 {
+			return "", false
+		}
+		// time.Duration can't span the centuries since 1601, so go through Unix time
+		return time.Unix(seconds-dstimeEpochOffset, 0).UTC().Format("20060102150405.0Z"), true
+	case 'm': // Unicode string
+		return ese.DecodeUnicode(value), true
+	case 'p': // Security descriptor
+		if len(value) == 8 {
+			sd, found := d.sds[int64(binary.LittleEndian.Uint64(value))]
+			return string(sd), found
+		}
+		return string(value), true
+	case 'q': // Large integer
+		if len(value) < 8 {
+			return "", false
+		}
+		return strconv.FormatInt(int64(binary.LittleEndian.Uint64(value)), 10), true
+	case 'r': // SID, RID is stored big endian
+		if len(value) < 12 {
+			return string(value), true
+		}
+		sid := make([]byte, len(value))
+		copy(sid, value)
+		rid := binary.BigEndian.Uint32(sid[len(sid)-4:])
+		binary.LittleEndian.PutUint32(sid[len(sid)-4:], rid)
+		return string(sid), true
+	}
+	// DN-String, presentation address etc. are not used by us
+	return "", false
+}
+
+// dn returns the distinguished name of a DNT by walking up the hierarchy
+func (d *ntdsDumper) dn(dnt int32) string {
+	return d.dnDepth(dnt, 0)
+}
+
+func (d *ntdsDumper) dnDepth(dnt int32, depth int) string {
+	if dn, found := d.dns[dnt]; found {
+		return dn
+	}
+	o := d.objects[dnt]
+	if o == nil || o.parent == 0 || o.rdn == "" || depth > 64 {
+		// The root object or something unknown
+		return ""
+	}
+
+	rdntype := d.attributes[o.rdntype]
+	if rdntype == "" {
+		rdntype = "CN"
+	} else if len(rdntype) <= 2 {
+		rdntype = strings.ToUpper(rdntype)
+	}
+
+	dn := rdntype + "=" + escapeRDN(o.rdn)
+	if parent := d.dnDepth(o.parent, depth+1); parent != "" {
+		dn += "," + parent
+	}
+	d.dns[dnt] = dn
+	return dn
+}
+
+func escapeRDN(value string) string {
+	var sb strings.Builder
+	for i, c := range value {
+		switch {
+		case c == ',' || c == '+' || c == '"' || c == '\\' || c == '<' || c == '>' || c == ';',
+			c == '#' && i == 0,
+			c == ' ' && (i == 0 || i == len(value)-1):
+			sb.WriteByte('\\')
+			sb.WriteRune(c)
+		case c < 0x20:
+			fmt.Fprintf(&sb, "\\%02X", c)
+		default:
+			sb.WriteRune(c)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,176 @@
+package collect
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	"github.com/lkarlslund/adalanche/modules/ese"
+)
+
+const (
+	fixtureAttCN = 3
+	fixtureAttDC = 1376281
+)
+
+// fixtureDumper returns a dumper with the tables that DumpFromNTDS would have read from a small domain:
+//
+//	2 (root) -> 3 DC=local -> 4 DC=corp -> 5 CN=Users -> 6 CN=Smith\, John
+//	                                                  -> 7 CN=Admins
+//	                                                  -> 8 CN=#Ops+Dev
+func fixtureDumper() *ntdsDumper {
+	d := &ntdsDumper{
+		objects: map[int32]*ntdsObject{
+			2: {parent: 0, rdn: "$ROOT_OBJECT$"},
+			3: {parent: 2, rdntype: fixtureAttDC, rdn: "local"},
+			4: {parent: 3, rdntype: fixtureAttDC, rdn: "corp", object: true},
+			5: {parent: 4, rdntype: fixtureAttCN, rdn: "Users", object: true},
+			6: {parent: 5, rdntype: fixtureAttCN, rdn: "Smith, John", object: true},
+			7: {parent: 5, rdntype: fixtureAttCN, rdn: "Admins", object: true},
+			8: {parent: 5, rdn: "#Ops+Dev", object: true},
+		},
+		dns: make(map[int32]string),
+		attributes: map[uint32]string{
+			fixtureAttCN: "cn",
+			fixtureAttDC: "dc",
+		},
+		syntaxes: map[string]byte{
+			"member":                    'b',
+			"memberOf":                  'b',
+			"msDS-KeyCredentialLink":    'h',
+			"msDS-KeyCredentialLink-BL": 'b',
+		},
+		classes: make(map[uint32]string),
+		linkids: map[int32]string{
+			2:   "member",
+			3:   "memberOf",
+			370: "msDS-KeyCredentialLink",
+			371: "msDS-KeyCredentialLink-BL",
+		},
+		links:      make(map[int32][]ntdsLink),
+		isdeleted:  &ese.Column{ID: 100, Name: "ATTi131120"},
+		isrecycled: &ese.Column{ID: 101, Name: "ATTi591882"},
+	}
+	// Link table rows: Admins has two members, and the user has a key credential
+	d.addLink(7, 6, 1, nil)
+	d.addLink(7, 8, 1, nil)
+	d.addLink(6, 5, 185, []byte{0xde, 0xad, 0xbe, 0xef})
+	// A link to an unknown object is dropped
+	d.addLink(7, 99, 1, nil)
+	return d
+}
+
+func TestNTDSDistinguishedNames(t *testing.T) {
+	d := fixtureDumper()
+	tests := []struct {
+		dnt  int32
+		want string
+	}{
+		{2, ""},
+		{3, "DC=local"},
+		{4, "DC=corp,DC=local"},
+		{5, "CN=Users,DC=corp,DC=local"},
+		{6, `CN=Smith\, John,CN=Users,DC=corp,DC=local`},
+		{8, `CN=\#Ops\+Dev,CN=Users,DC=corp,DC=local`},
+		{99, ""},
+	}
+	for _, tt := range tests {
+		if got := d.dn(tt.dnt); got != tt.want {
+			t.Errorf("dn(%v) = %q, want %q", tt.dnt, got, tt.want)
+		}
+	}
+}
+
+func TestNTDSLinks(t *testing.T) {
+	d := fixtureDumper()
+	tests := []struct {
+		name      string
+		dnt       int32
+		attribute string
+		want      []string
+	}{
+		{"forward", 7, "member", []string{
+			`CN=Smith\, John,CN=Users,DC=corp,DC=local`,
+			`CN=\#Ops\+Dev,CN=Users,DC=corp,DC=local`,
+		}},
+		{"backlink", 6, "memberOf", []string{"CN=Admins,CN=Users,DC=corp,DC=local"}},
+		{"dn-binary", 6, "msDS-KeyCredentialLink", []string{"B:8:DEADBEEF:CN=Users,DC=corp,DC=local"}},
+		{"dn-binary backlink", 5, "msDS-KeyCredentialLink-BL", []string{`CN=Smith\, John,CN=Users,DC=corp,DC=local`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ro, ok := d.rawObject(tt.dnt, ese.Record{})
+			if !ok {
+				t.Fatalf("rawObject(%v) returned no object", tt.dnt)
+			}
+			if got := ro.Attributes[tt.attribute]; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%v = %q, want %q", tt.attribute, got, tt.want)
+			}
+		})
+	}
+
+	if _, ok := d.rawObject(2, ese.Record{}); ok {
+		t.Error("rawObject returned the root object")
+	}
+}
+
+func TestNTDSDeleted(t *testing.T) {
+	d := fixtureDumper()
+	set := [][]byte{{1, 0, 0, 0}}
+	unset := [][]byte{{0, 0, 0, 0}}
+	tests := []struct {
+		name   string
+		record ese.Record
+		want   bool
+	}{
+		{"live", ese.Record{}, false},
+		{"cleared", ese.Record{100: unset, 101: unset}, false},
+		{"tombstone", ese.Record{100: set}, true},
+		{"recycled", ese.Record{101: set}, true},
+	}
+	for _, tt := range tests {
+		if got := d.deleted(tt.record); got != tt.want {
+			t.Errorf("%v: deleted = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNTDSDecode(t *testing.T) {
+	d := fixtureDumper()
+	u32 := func(v uint32) []byte {
+		b := make([]byte, 4)
+		binary.LittleEndian.PutUint32(b, v)
+		return b
+	}
+	u64 := func(v uint64) []byte {
+		b := make([]byte, 8)
+		binary.LittleEndian.PutUint64(b, v)
+		return b
+	}
+	sid := []byte{1, 2, 0, 0, 0, 0, 0, 5, 32, 0, 0, 0, 0, 0, 0x02, 0x20}
+	wantsid := []byte{1, 2, 0, 0, 0, 0, 0, 5, 32, 0, 0, 0, 0x20, 0x02, 0, 0}
+	tests := []struct {
+		name   string
+		syntax byte
+		value  []byte
+		want   string
+		ok     bool
+	}{
+		{"dn", 'b', u32(7), "CN=Admins,CN=Users,DC=corp,DC=local", true},
+		{"dn unknown", 'b', u32(99), "", false},
+		{"oid", 'c', u32(fixtureAttCN), "cn", true},
+		{"boolean", 'i', u32(1), "TRUE", true},
+		{"integer", 'j', u32(0xffffffff), "-1", true},
+		{"time", 'l', u64(13000000000), "20121214230640.0Z", true},
+		{"time unset", 'l', u64(0), "", false},
+		{"large integer", 'q', u64(1 << 40), "1099511627776", true},
+		{"sid", 'r', sid, string(wantsid), true},
+		{"short", 'j', []byte{1}, "", false},
+	}
+	for _, tt := range tests {
+		got, ok := d.decode(tt.syntax, tt.value)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%v: decode = %q, %v, want %q, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package activedirectory
+
+import "github.com/lkarlslund/adalanche/modules/basedata"
+
+// ForestManifest is saved by the collector when doing a forest wide collection, and describes the domains and trusts found
+type ForestManifest struct {
+	basedata.Common
+	RootDomain    string         `json:",omitempty"`
+	Configuration string         `json:",omitempty"`
+	Domains       []ForestDomain `json:",omitempty"`
+	Trusts        []ForestTrust  `json:",omitempty"`
+}
+
+type ForestDomain struct {
+	DistinguishedName string `json:",omitempty"`
+	DNSRoot           string `json:",omitempty"`
+	NetBIOSName       string `json:",omitempty"`
+	Server            string `json:",omitempty"`
+	Path              string `json:",omitempty"` // Subfolder relative to the manifest
+	Error             string `json:",omitempty"` // Set if collection failed
+}
+
+type ForestTrust struct {
+	Domain          string `json:",omitempty"` // Domain holding the trustedDomain object
+	TrustPartner    string `json:",omitempty"`
+	FlatName        string `json:",omitempty"`
+	SID             string `json:",omitempty"`
+	TrustDirection  int    `json:",omitempty"`
+	TrustType       int    `json:",omitempty"`
+	TrustAttributes int    `json:",omitempty"`
+}
+
+// Trust properties from MS-ADTS 6.1.6.7
+const (
+	TRUST_DIRECTION_INBOUND  = 0x01
+	TRUST_DIRECTION_OUTBOUND = 0x02
+
+	TRUST_TYPE_DOWNLEVEL = 1
+	TRUST_TYPE_UPLEVEL   = 2
+	TRUST_TYPE_MIT       = 3
+	TRUST_TYPE_DCE       = 4
+	TRUST_TYPE_AAD       = 5
+
+	TRUST_ATTRIBUTE_NON_TRANSITIVE                     = 0x001
+	TRUST_ATTRIBUTE_UPLEVEL_ONLY                       = 0x002
+	TRUST_ATTRIBUTE_QUARANTINED_DOMAIN                 = 0x004
+	TRUST_ATTRIBUTE_FOREST_TRANSITIVE                  = 0x008
+	TRUST_ATTRIBUTE_CROSS_ORGANIZATION                 = 0x010
+	TRUST_ATTRIBUTE_WITHIN_FOREST                      = 0x020
+	TRUST_ATTRIBUTE_TREAT_AS_EXTERNAL                  = 0x040
+	TRUST_ATTRIBUTE_USES_RC4_ENCRYPTION                = 0x080
+	TRUST_ATTRIBUTE_CROSS_ORGANIZATION_NO_TGT_DELEGATE = 0x200
+	TRUST_ATTRIBUTE_PIM_TRUST                          = 0x400
+	TRUST_ATTRIBUTE_CROSS_ORGANIZATION_ENABLE_TGT_DELE = 0x800
+)
@@ -0,0 +1,120 @@
+package activedirectory
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/lkarlslund/adalanche/modules/util"
+)
+
+// KEYCREDENTIALLINK_ENTRY identifiers from MS-ADTS 2.2.20.6
+const (
+	KEYCREDENTIAL_KEYID                       = 0x01
+	KEYCREDENTIAL_KEYHASH                     = 0x02
+	KEYCREDENTIAL_KEYMATERIAL                 = 0x03
+	KEYCREDENTIAL_KEYUSAGE                    = 0x04
+	KEYCREDENTIAL_KEYSOURCE                   = 0x05
+	KEYCREDENTIAL_DEVICEID                    = 0x06
+	KEYCREDENTIAL_CUSTOMKEYINFORMATION        = 0x07
+	KEYCREDENTIAL_KEYAPPROXIMATELASTLOGONTIME = 0x08
+	KEYCREDENTIAL_KEYCREATIONTIME             = 0x09
+
+	KEYCREDENTIAL_VERSION_2 = 0x200
+)
+
+// KeyCredential is a decoded KEYCREDENTIALLINK_BLOB from msDS-KeyCredentialLink
+type KeyCredential struct {
+	Version     uint32
+	KeyID       []byte
+	KeyMaterial []byte
+	Usage       byte
+	Source      byte
+	DeviceID    uuid.UUID
+	LastLogon   time.Time
+	Created     time.Time
+	Owner       string
+}
+
+func (kc KeyCredential) KeyIDString() string {
+	return hex.EncodeToString(kc.KeyID)
+}
+
+// ParseKeyCredentialLink decodes a DN-Binary value in the "B:<length>:<hex>:<dn>" format
+func ParseKeyCredentialLink(value string) (KeyCredential, error) {
+	var kc KeyCredential
+	parts := strings.SplitN(value, ":", 4)
+	if len(parts) != 4 || parts[0] != "B" {
+		return kc, errors.New("key credential link is not in DN-Binary format")
+	}
+	length, err := strconv.Atoi(parts[1])
+	if err != nil || length != len(parts[2]) {
+		return kc, fmt.Errorf("key credential link has invalid length %v", parts[1])
+	}
+	blob, err := hex.DecodeString(parts[2])
+	if err != nil {
+		return kc, fmt.Errorf("key credential link has invalid hex data: %v", err)
+	}
+	kc, err = ParseKeyCredential(blob)
+	kc.Owner = parts[3]
+	return kc, err
+}
+
+// ParseKeyCredential decodes the KEYCREDENTIALLINK_BLOB structure
+func ParseKeyCredential(blob []byte) (KeyCredential, error) {
+	var kc KeyCredential
+	if len(blob) < 4 {
+		return kc, errors.New("key credential blob is too short")
+	}
+	kc.Version = binary.LittleEndian.Uint32(blob)
+	if kc.Version != KEYCREDENTIAL_VERSION_2 {
+		return kc, fmt.Errorf("unsupported key credential version %x", kc.Version)
+	}
+
+	data := blob[4:]
+	for len(data) > 0 {
+		if len(data) < 3 {
+			return kc, errors.New("key credential entry header is truncated")
+		}
+		length := int(binary.LittleEndian.Uint16(data))
+		identifier := data[2]
+		if len(data) < 3+length {
+			return kc, fmt.Errorf("key credential entry %v is truncated", identifier)
+		}
+		value := data[3 : 3+length]
+		data = data[3+length:]
+
+		switch identifier {
+		case KEYCREDENTIAL_KEYID:
+			kc.KeyID = value
+		case KEYCREDENTIAL_KEYMATERIAL:
+			kc.KeyMaterial = value
+		case KEYCREDENTIAL_KEYUSAGE:
+			if len(value) > 0 {
+				kc.Usage = value[0]
+			}
+		case KEYCREDENTIAL_KEYSOURCE:
+			if len(value) > 0 {
+				kc.Source = value[0]
+			}
+		case KEYCREDENTIAL_DEVICEID:
+			if guid, err := uuid.FromBytes(value); err == nil {
+				kc.DeviceID = util.SwapUUIDEndianess(guid)
+			}
+		case KEYCREDENTIAL_KEYAPPROXIMATELASTLOGONTIME:
+			if len(value) == 8 {
+				kc.LastLogon = util.FiletimeToTime(binary.LittleEndian.Uint64(value))
+			}
+		case KEYCREDENTIAL_KEYCREATIONTIME:
+			if len(value) == 8 {
+				kc.Created = util.FiletimeToTime(binary.LittleEndian.Uint64(value))
+			}
+		}
+	}
+	return kc, nil
+}
@@ -0,0 +1,54 @@
+package activedirectory
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/lkarlslund/adalanche/modules/util"
+	"github.com/lkarlslund/adalanche/modules/windowssecurity"
+)
+
+// LAPSEncryptedPassword is the header of the msLAPS-Encrypted* attributes, followed by a CMS blob protected with DPAPI-NG
+type LAPSEncryptedPassword struct {
+	Updated             time.Time
+	Size                uint32
+	AuthorizedDecryptor windowssecurity.SID
+}
+
+var ErrLAPSBlobTooShort = errors.New("LAPS encrypted password blob is too short")
+
+// The DPAPI-NG protection descriptor in the CMS blob contains the UTF8String "SID" followed by the UTF8String with the principal
+var lapsSIDDescriptor = []byte{0x0c, 0x03, 'S', 'I', 'D', 0x0c}
+
+// ParseLAPSEncryptedPassword decodes the header and the authorized decryptor from a Windows LAPS encrypted password
+func ParseLAPSEncryptedPassword(data []byte) (LAPSEncryptedPassword, error) {
+	var result LAPSEncryptedPassword
+	if len(data) < 16 {
+		return result, ErrLAPSBlobTooShort
+	}
+
+	// Timestamp is stored with the high part first
+	filetime := uint64(binary.LittleEndian.Uint32(data[0:]))<<32 | uint64(binary.LittleEndian.Uint32(data[4:]))
+	result.Updated = util.FiletimeToTime(filetime)
+	result.Size = binary.LittleEndian.Uint32(data[8:])
+
+	cms := data[16:]
+	pos := bytes.Index(cms, lapsSIDDescriptor)
+	if pos == -1 || pos+len(lapsSIDDescriptor) >= len(cms) {
+		return result, errors.New("authorized decryptor not found in LAPS encrypted password blob")
+	}
+	cms = cms[pos+len(lapsSIDDescriptor):]
+	length := int(cms[0])
+	if length > 0x7f || length+1 > len(cms) {
+		return result, errors.New("invalid authorized decryptor length in LAPS encrypted password blob")
+	}
+
+	sid, err := windowssecurity.SIDFromString(string(cms[1 : 1+length]))
+	if err != nil {
+		return result, err
+	}
+	result.AuthorizedDecryptor = sid
+	return result, nil
+}
@@ -50,20 +50,21 @@ var (
 	PwnDSReplicationGetChangesInFilteredSet = engine.NewPwn("DSReplGetChngsInFiltSet")
 	PwnDCsync                               = engine.NewPwn("DCsync")
 	PwnReadLAPSPassword                     = engine.NewPwn("ReadLAPSPassword")
+	PwnDecryptLAPSPassword                  = engine.NewPwn("DecryptLAPSPassword").Describe("Authorized decryptor of Windows LAPS encrypted password, or able to read it where the decryptor is unknown")
 	PwnMemberOfGroup                        = engine.NewPwn("MemberOfGroup")
 	PwnHasSPN                               = engine.NewPwn("HasSPN").Describe("Kerberoastable by requesting Kerberos service ticket against SPN and then bruteforcing the ticket").RegisterProbabilityCalculator(func(source, target *engine.Object) engine.Probability {
 		if uac, ok := target.AttrInt(UserAccountControl); ok && uac&0x0002 /*UAC_ACCOUNTDISABLE*/ != 0 {
 			// Account is disabled
 			return 0
 		}
-		return 50
+		return crackProbability(target)
 	})
 	PwnDontReqPreauth = engine.NewPwn("DontReqPreauth").Describe("Kerberoastable by AS-REP by requesting a TGT and then bruteforcing the ticket").RegisterProbabilityCalculator(func(source, target *engine.Object) engine.Probability {
 		if uac, ok := target.AttrInt(UserAccountControl); ok && uac&0x0002 /*UAC_ACCOUNTDISABLE*/ != 0 {
 			// Account is disabled
 			return 0
 		}
-		return 50
+		return crackProbability(target)
 	})
 	PwnOverwritesACL              = engine.NewPwn("OverwritesACL")
 	PwnAffectedByGPO              = engine.NewPwn("AffectedByGPO")
@@ -77,4 +78,88 @@ var (
 	PwnWriteProfilePath           = engine.NewPwn("WriteProfilePath")
 	PwnWriteScriptPath            = engine.NewPwn("WriteScriptPath")
 	PwnCertificateEnroll          = engine.NewPwn("CertificateEnroll")
+	PwnCrossTrust                 = engine.NewPwn("CrossTrust").Describe("Trusted domain can add privileged SIDs from the trusting domain to tickets crossing the trust, as SID filtering does not remove them").RegisterProbabilityCalculator(func(source, target *engine.Object) engine.Probability {
+		trust := source
+		if trust.Type() != engine.ObjectTypeTrust {
+			trust = target
+		}
+		if attr, ok := trust.AttrInt(TrustAttributes); ok && attr&TRUST_ATTRIBUTE_FOREST_TRANSITIVE != 0 {
+			// SID history enabled on a forest trust, RIDs below 1000 are still filtered so only custom groups pass
+			return 50
+		}
+		return 100
+	})
+	PwnDNSCreateRecord = engine.NewPwn("DNSCreateRecord").Describe("Can create records in an AD integrated DNS zone, allowing wildcard, WPAD or missing host records to be injected for man-in-the-middle and relaying").RegisterProbabilityCalculator(func(source, target *engine.Object) engine.Probability {
+		return 20
+	})
+	PwnDNSWriteRecord = engine.NewPwn("DNSWriteRecord").Describe("Can modify the DNS record of the host, redirecting traffic for man-in-the-middle and relaying").RegisterProbabilityCalculator(func(source, target *engine.Object) engine.Probability {
+		return 30
+	})
+	PwnRODCCachedCredentials = engine.NewPwn("RODCCachedCreds").Describe("Credentials of the account are cached on the read-only domain controller")
+	PwnRODCRevealOnDemand    = engine.NewPwn("RODCRevealOnDemand").Describe("Password replication policy allows the read-only domain controller to cache the credentials of the account when it authenticates").RegisterProbabilityCalculator(func(source, target *engine.Object) engine.Probability {
+		return 50
+	})
+	PwnBackupOperator = engine.NewPwn("BackupOperator").Describe("Backup Operators can remotely save the registry hives and NTDS.dit from a domain controller, exposing the machine account and all domain credentials").RegisterProbabilityCalculator(func(source, target *engine.Object) engine.Probability {
+		return 90
+	})
+	PwnServerOperator = engine.NewPwn("ServerOperator").Describe("Server Operators can log on to domain controllers and reconfigure services to run arbitrary commands as SYSTEM").RegisterProbabilityCalculator(func(source, target *engine.Object) engine.Probability {
+		return 90
+	})
+	PwnPrintOperator = engine.NewPwn("PrintOperator").Describe("Print Operators can log on to domain controllers and load kernel drivers via SeLoadDriverPrivilege").RegisterProbabilityCalculator(func(source, target *engine.Object) engine.Probability {
+		return 50
+	})
+	PwnAccountOperator = engine.NewPwn("AccountOperator").Describe("Account Operators can modify non-protected users, groups and computers, and log on to domain controllers").RegisterProbabilityCalculator(func(source, target *engine.Object) engine.Probability {
+		if uac, ok := target.AttrInt(UserAccountControl); ok && uac&0x2000 /*UAC_SERVER_TRUST_ACCOUNT*/ != 0 {
+			// Local logon to a DC only, no direct code execution
+			return 20
+		}
+		return 100
+	})
+	PwnDnsAdmin = engine.NewPwn("DnsAdmin").Describe("DnsAdmins can make the DNS service on domain controllers load an arbitrary DLL as SYSTEM via ServerLevelPluginDll, effective at next service restart").RegisterProbabilityCalculator(func(source, target *engine.Object) engine.Probability {
+		return 50
+	})
+	PwnAddComputer        = engine.NewPwn("AddComputer").Describe("Can add a new computer account to the domain, either via the machine account quota or create child rights for computers")
+	PwnHasSyncCredentials = engine.NewPwn("HasSyncCredentials").Describe("Server running Azure AD Connect stores the credentials for the directory synchronization account")
+	PwnRunsAs             = engine.NewPwn("RunsAs")
+
+	// Found in GPO registry settings as well as by the local machine collector
+	PwnHasAutoAdminLogonCredentials = engine.NewPwn("AutoAdminLogonCreds")
+
+	// Privileges granted via GPO user rights assignments, shared with the localmachine analyzer
+	PwnSeBackupPrivilege    = engine.NewPwn("SeBackupPrivilege")
+	PwnSeRestorePrivilege   = engine.NewPwn("SeRestorePrivilege")
+	PwnSeAssignPrimaryToken = engine.NewPwn("SeAssignPrimaryToken")
+	PwnSeCreateToken        = engine.NewPwn("SeCreateToken")
+	PwnSeDebug              = engine.NewPwn("SeDebug")
+	PwnSeImpersonate        = engine.NewPwn("SeImpersonate").RegisterProbabilityCalculator(func(source, target *engine.Object) engine.Probability { return 20 })
+	PwnSeLoadDriver         = engine.NewPwn("SeLoadDriver")
+	PwnSeManageVolume       = engine.NewPwn("SeManageVolume")
+	PwnSeTakeOwnership      = engine.NewPwn("SeTakeOwnership")
+	PwnSeTcb                = engine.NewPwn("SeTcb")
+
+	PwnScriptWrite    = engine.NewPwn("ScriptWrite").Describe("Can modify a script run by the target, by writing it or taking over the file or a parent folder")
+	PwnGPPSourceWrite = engine.NewPwn("GPPSourceWrite").Describe("Can modify a file that Group Policy Preferences copy to or run on the target")
 )
+
+// crackProbability estimates how likely an offline bruteforce of the accounts password is, based on the effective password policy
+func crackProbability(target *engine.Object) engine.Probability {
+	minlength, ok := target.AttrInt(MetaPasswordMinLength)
+	if !ok {
+		return 50
+	}
+	var probability engine.Probability
+	switch {
+	case minlength < 8:
+		probability = 80
+	case minlength < 12:
+		probability = 60
+	case minlength < 15:
+		probability = 40
+	default:
+		probability = 20
+	}
+	if complexity, ok := target.AttrInt(MetaPasswordComplexity); ok && complexity == 0 {
+		probability += 10
+	}
+	return probability
+}
@@ -84,7 +84,7 @@ func EncodeAttributeData(attribute engine.Attribute, values []string) engine.Att
 		var attributevalue engine.AttributeValue
 		switch attribute {
 		// Add more things here, like time decoding etc
-		case AccountExpires, PwdLastSet, LastLogon, LastLogonTimestamp, MSmcsAdmPwdExpirationTime:
+		case AccountExpires, PwdLastSet, LastLogon, LastLogonTimestamp, MSmcsAdmPwdExpirationTime, MSLAPSPwdExpirationTime:
 			// Just use string encoding
 			if intval, err := strconv.ParseInt(value, 10, 64); err == nil {
 				if attribute == PwdLastSet && intval == 0 {
@@ -119,7 +119,7 @@ func EncodeAttributeData(attribute engine.Attribute, values []string) engine.Att
 			default:
 				log.Warn().Msgf("Failed to convert attribute %v value %2x to timestamp (unsupported length): %v", attribute.String(), tvalue)
 			}
-		case AttributeSecurityGUID, SchemaIDGUID, MSDSConsistencyGUID:
+		case AttributeSecurityGUID, SchemaIDGUID, MSDSConsistencyGUID, MSDSDeviceID:
 			switch len(value) {
 			case 16:
 				guid, err := uuid.FromBytes([]byte(value))
@@ -156,6 +156,9 @@ func EncodeAttributeData(attribute engine.Attribute, values []string) engine.Att
 			}
 		case ObjectSid, SIDHistory, SecurityIdentifier:
 			attributevalue = engine.AttributeValueSID(value)
+		case MSLAPSEncryptedPassword, MSLAPSEncryptedDSRMPwd, MSDSReplAttributeMetaData, MSDSReplValueMetaData:
+			// Binary blob or XML, don't let auto conversion touch it
+			attributevalue = engine.AttributeValueString(value)
 		default:
 			// AUTO CONVERSION - WHAT COULD POSSIBLY GO WRONG
 
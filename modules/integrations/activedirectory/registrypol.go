@@ -0,0 +1,159 @@
+package activedirectory
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// Registry value types used in Registry.pol
+const (
+	REG_NONE                = 0
+	REG_SZ                  = 1
+	REG_EXPAND_SZ           = 2
+	REG_BINARY              = 3
+	REG_DWORD               = 4
+	REG_DWORD_BIG_ENDIAN    = 5
+	REG_LINK                = 6
+	REG_MULTI_SZ            = 7
+	REG_QWORD               = 11
+	REGISTRYPOL_SIGNATURE   = 0x67655250 // "PReg"
+	REGISTRYPOL_VERSION     = 1
+	registryPolHeaderLength = 8
+)
+
+var ErrNotRegistryPol = errors.New("data is not in Registry.pol (PReg) format")
+
+// RegistryPolEntry is a single setting from a Registry.pol file
+type RegistryPolEntry struct {
+	Key       string
+	ValueName string
+	Type      uint32
+	Data      []byte
+}
+
+// ParseRegistryPol decodes the PReg format used by administrative templates in GPOs
+func ParseRegistryPol(data []byte) ([]RegistryPolEntry, error) {
+	if len(data) < registryPolHeaderLength || binary.LittleEndian.Uint32(data) != REGISTRYPOL_SIGNATURE {
+		return nil, ErrNotRegistryPol
+	}
+	if version := binary.LittleEndian.Uint32(data[4:]); version != REGISTRYPOL_VERSION {
+		return nil, fmt.Errorf("unsupported Registry.pol version %v", version)
+	}
+
+	var results []RegistryPolEntry
+	data = data[registryPolHeaderLength:]
+	for len(data) > 0 {
+		// Each entry is [key;value;type;size;data] with UTF-16 delimiters
+		if len(data) < 2 || binary.LittleEndian.Uint16(data) != '[' {
+			return results, errors.New("Registry.pol entry does not start with '['")
+		}
+		data = data[2:]
+
+		var entry RegistryPolEntry
+		var err error
+		if entry.Key, data, err = readPolString(data); err != nil {
+			return results, err
+		}
+		if entry.ValueName, data, err = readPolString(data); err != nil {
+			return results, err
+		}
+		if len(data) < 12 {
+			return results, errors.New("Registry.pol entry is truncated")
+		}
+		entry.Type = binary.LittleEndian.Uint32(data)
+		if binary.LittleEndian.Uint16(data[4:]) != ';' {
+			return results, errors.New("Registry.pol entry has invalid type delimiter")
+		}
+		size := int(binary.LittleEndian.Uint32(data[6:]))
+		if binary.LittleEndian.Uint16(data[10:]) != ';' {
+			return results, errors.New("Registry.pol entry has invalid size delimiter")
+		}
+		data = data[12:]
+		if len(data) < size+2 {
+			return results, errors.New("Registry.pol entry data is truncated")
+		}
+		entry.Data = data[:size]
+		if binary.LittleEndian.Uint16(data[size:]) != ']' {
+			return results, errors.New("Registry.pol entry does not end with ']'")
+		}
+		data = data[size+2:]
+
+		results = append(results, entry)
+	}
+	return results, nil
+}
+
+// readPolString reads a null terminated UTF-16 string followed by a ';' delimiter
+func readPolString(data []byte) (string, []byte, error) {
+	var chars []uint16
+	for {
+		if len(data) < 2 {
+			return "", data, errors.New("Registry.pol string is truncated")
+		}
+		c := binary.LittleEndian.Uint16(data)
+		data = data[2:]
+		if c == 0 {
+			break
+		}
+		chars = append(chars, c)
+	}
+	if len(data) < 2 || binary.LittleEndian.Uint16(data) != ';' {
+		return "", data, errors.New("Registry.pol string is not followed by ';'")
+	}
+	return string(utf16.Decode(chars)), data[2:], nil
+}
+
+// IsDeletion returns true for the special **del., **delvals., **deletevalues and **deletekeys entries that remove values instead of setting them
+func (rpe RegistryPolEntry) IsDeletion() bool {
+	return strings.HasPrefix(strings.ToLower(rpe.ValueName), "**del")
+}
+
+// Int returns the value as a number, converting string values if needed
+func (rpe RegistryPolEntry) Int() (int64, bool) {
+	switch rpe.Type {
+	case REG_DWORD:
+		if len(rpe.Data) >= 4 {
+			return int64(binary.LittleEndian.Uint32(rpe.Data)), true
+		}
+	case REG_DWORD_BIG_ENDIAN:
+		if len(rpe.Data) >= 4 {
+			return int64(binary.BigEndian.Uint32(rpe.Data)), true
+		}
+	case REG_QWORD:
+		if len(rpe.Data) >= 8 {
+			return int64(binary.LittleEndian.Uint64(rpe.Data)), true
+		}
+	case REG_SZ, REG_EXPAND_SZ:
+		if i, err := strconv.ParseInt(strings.TrimSpace(rpe.String()), 10, 64); err == nil {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// String returns a readable rendering of the value data
+func (rpe RegistryPolEntry) String() string {
+	switch rpe.Type {
+	case REG_SZ, REG_EXPAND_SZ, REG_LINK:
+		return strings.TrimRight(decodeUTF16(rpe.Data), "\x00")
+	case REG_MULTI_SZ:
+		return strings.Join(strings.FieldsFunc(decodeUTF16(rpe.Data), func(r rune) bool { return r == 0 }), ", ")
+	case REG_DWORD, REG_DWORD_BIG_ENDIAN, REG_QWORD:
+		if i, ok := rpe.Int(); ok {
+			return strconv.FormatInt(i, 10)
+		}
+	}
+	return hex.EncodeToString(rpe.Data)
+}
+
+func decodeUTF16(data []byte) string {
+	chars := make([]uint16, len(data)/2)
+	binary.Read(bytes.NewReader(data[:len(chars)*2]), binary.LittleEndian, chars)
+	return string(utf16.Decode(chars))
+}
@@ -0,0 +1,106 @@
+package activedirectory
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+	"unicode/utf16"
+)
+
+func polString(buf *bytes.Buffer, s string) {
+	binary.Write(buf, binary.LittleEndian, utf16.Encode([]rune(s+"\x00")))
+}
+
+// encodeRegistryPol is the inverse of ParseRegistryPol
+func encodeRegistryPol(entries []RegistryPolEntry) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, []uint32{REGISTRYPOL_SIGNATURE, REGISTRYPOL_VERSION})
+	for _, entry := range entries {
+		binary.Write(&buf, binary.LittleEndian, uint16('['))
+		polString(&buf, entry.Key)
+		binary.Write(&buf, binary.LittleEndian, uint16(';'))
+		polString(&buf, entry.ValueName)
+		binary.Write(&buf, binary.LittleEndian, uint16(';'))
+		binary.Write(&buf, binary.LittleEndian, entry.Type)
+		binary.Write(&buf, binary.LittleEndian, uint16(';'))
+		binary.Write(&buf, binary.LittleEndian, uint32(len(entry.Data)))
+		binary.Write(&buf, binary.LittleEndian, uint16(';'))
+		buf.Write(entry.Data)
+		binary.Write(&buf, binary.LittleEndian, uint16(']'))
+	}
+	return buf.Bytes()
+}
+
+func TestParseRegistryPol(t *testing.T) {
+	var sz bytes.Buffer
+	polString(&sz, "1")
+	entries := []RegistryPolEntry{
+		{
+			Key:       `Software\Policies\Microsoft Services\AdmPwd`,
+			ValueName: "AdmPwdEnabled",
+			Type:      REG_DWORD,
+			Data:      []byte{1, 0, 0, 0},
+		},
+		{
+			Key:       `Software\Microsoft\Windows NT\CurrentVersion\Winlogon`,
+			ValueName: "AutoAdminLogon",
+			Type:      REG_SZ,
+			Data:      sz.Bytes(),
+		},
+		{
+			Key:       `System\CurrentControlSet\Control\SecurityProviders\WDigest`,
+			ValueName: "**del.UseLogonCredential",
+			Type:      REG_SZ,
+			Data:      []byte{' ', 0},
+		},
+	}
+	data := encodeRegistryPol(entries)
+
+	t.Run("round trip", func(t *testing.T) {
+		parsed, err := ParseRegistryPol(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(parsed, entries) {
+			t.Fatalf("got %+v, want %+v", parsed, entries)
+		}
+
+		if parsed[0].IsDeletion() || parsed[1].IsDeletion() || !parsed[2].IsDeletion() {
+			t.Error("wrong entries are marked as deletions")
+		}
+		for i, want := range []int64{1, 1} {
+			if got, ok := parsed[i].Int(); !ok || got != want {
+				t.Errorf("entry %v Int() = %v, %v, want %v", i, got, ok, want)
+			}
+		}
+		if got := parsed[1].String(); got != "1" {
+			t.Errorf("entry 1 String() = %q, want \"1\"", got)
+		}
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		// Cut off in the middle of the last entry, the complete ones are still returned
+		parsed, err := ParseRegistryPol(data[:len(data)-3])
+		if err == nil {
+			t.Fatal("no error for truncated data")
+		}
+		if !reflect.DeepEqual(parsed, entries[:2]) {
+			t.Errorf("got %+v, want the first two entries", parsed)
+		}
+	})
+
+	t.Run("truncated string", func(t *testing.T) {
+		parsed, err := ParseRegistryPol(data[:registryPolHeaderLength+6])
+		if err == nil || len(parsed) != 0 {
+			t.Errorf("got %v entries and error %v, want none and an error", len(parsed), err)
+		}
+	})
+
+	t.Run("not registry.pol", func(t *testing.T) {
+		if _, err := ParseRegistryPol([]byte("[Unicode]\r\nUnicode=yes")); !errors.Is(err, ErrNotRegistryPol) {
+			t.Errorf("got error %v, want %v", err, ErrNotRegistryPol)
+		}
+	})
+}
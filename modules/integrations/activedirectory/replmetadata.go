@@ -0,0 +1,88 @@
+package activedirectory
+
+import (
+	"encoding/xml"
+	"strings"
+	"time"
+)
+
+// ReplAttributeMetaData is the XML rendering of DS_REPL_ATTR_META_DATA returned in msDS-ReplAttributeMetaData
+type ReplAttributeMetaData struct {
+	XMLName                        xml.Name  `xml:"DS_REPL_ATTR_META_DATA"`
+	AttributeName                  string    `xml:"pszAttributeName"`
+	Version                        int       `xml:"dwVersion"`
+	LastOriginatingChange          time.Time `xml:"ftimeLastOriginatingChange"`
+	LastOriginatingDsaInvocationID string    `xml:"uuidLastOriginatingDsaInvocationID"`
+	OriginatingChange              int64     `xml:"usnOriginatingChange"`
+	LocalChange                    int64     `xml:"usnLocalChange"`
+	LastOriginatingDsaDN           string    `xml:"pszLastOriginatingDsaDN"`
+}
+
+// ReplValueMetaData is the XML rendering of DS_REPL_VALUE_META_DATA returned in msDS-ReplValueMetaData
+type ReplValueMetaData struct {
+	XMLName                        xml.Name  `xml:"DS_REPL_VALUE_META_DATA"`
+	AttributeName                  string    `xml:"pszAttributeName"`
+	ObjectDN                       string    `xml:"pszObjectDn"`
+	Deleted                        time.Time `xml:"ftimeDeleted"`
+	Created                        time.Time `xml:"ftimeCreated"`
+	Version                        int       `xml:"dwVersion"`
+	LastOriginatingChange          time.Time `xml:"ftimeLastOriginatingChange"`
+	LastOriginatingDsaInvocationID string    `xml:"uuidLastOriginatingDsaInvocationID"`
+	OriginatingChange              int64     `xml:"usnOriginatingChange"`
+	LocalChange                    int64     `xml:"usnLocalChange"`
+	LastOriginatingDsaDN           string    `xml:"pszLastOriginatingDsaDN"`
+}
+
+func ParseReplAttributeMetaData(value string) (ReplAttributeMetaData, error) {
+	var result ReplAttributeMetaData
+	err := xml.Unmarshal([]byte(strings.TrimRight(value, "\x00")), &result)
+	return result, err
+}
+
+func ParseReplValueMetaData(value string) (ReplValueMetaData, error) {
+	var result ReplValueMetaData
+	err := xml.Unmarshal([]byte(strings.TrimRight(value, "\x00")), &result)
+	return result, err
+}
+
+// IsDeleted returns true if the linked value has been removed (the deletion time is set to something after 1601)
+func (rvmd ReplValueMetaData) IsDeleted() bool {
+	return rvmd.Deleted.Year() > 1601
+}
+
+// replBookkeepingAttributes are updated by logons and password handling, so they change all the time without anyone touching the object
+var replBookkeepingAttributes = map[string]struct{}{
+	"lastlogontimestamp":      {},
+	"pwdlastset":              {},
+	"unicodepwd":              {},
+	"dbcspwd":                 {},
+	"ntpwdhistory":            {},
+	"lmpwdhistory":            {},
+	"supplementalcredentials": {},
+	"badpasswordtime":         {},
+	"lockouttime":             {},
+	"msds-keyversionnumber":   {},
+}
+
+// IsBookkeeping returns true if the attribute is routinely changed by logons or password changes
+func (ramd ReplAttributeMetaData) IsBookkeeping() bool {
+	_, found := replBookkeepingAttributes[strings.ToLower(ramd.AttributeName)]
+	return found
+}
+
+func (rvmd ReplValueMetaData) OriginatingDC() string {
+	return originatingDC(rvmd.LastOriginatingDsaDN, rvmd.LastOriginatingDsaInvocationID)
+}
+
+func (ramd ReplAttributeMetaData) OriginatingDC() string {
+	return originatingDC(ramd.LastOriginatingDsaDN, ramd.LastOriginatingDsaInvocationID)
+}
+
+// originatingDC extracts the server name from "CN=NTDS Settings,CN=<server>,CN=Servers,...", falling back to the invocation ID for removed DCs
+func originatingDC(dsadn, invocationid string) string {
+	parts := strings.Split(dsadn, ",")
+	if len(parts) > 1 && strings.HasPrefix(strings.ToUpper(parts[1]), "CN=") && !strings.Contains(dsadn, "\\0ADEL:") {
+		return parts[1][3:]
+	}
+	return invocationid
+}
@@ -20,8 +20,19 @@ var (
 	ShareType               = engine.NewAttribute("shareType")
 	ServiceStart            = engine.NewAttribute("serviceStart")
 	ServiceType             = engine.NewAttribute("serviceType")
+	TaskPath                = engine.NewAttribute("taskPath").Single()
 
-	PwnLocalAdminRights             = engine.NewPwn("AdminRights")
+	UACEnableLUA                     = engine.NewAttribute("uacEnableLUA").Single()
+	UACLocalAccountTokenFilterPolicy = engine.NewAttribute("uacLocalAccountTokenFilterPolicy").Single()
+	UACFilterAdministratorToken      = engine.NewAttribute("uacFilterAdministratorToken").Single()
+
+	PwnLocalAdminRights = engine.NewPwn("AdminRights").Describe("Member of the local Administrators group. Remote UAC filters the token of local accounts other than RID 500 on network logons, so these only get admin rights interactively or over RDP").RegisterProbabilityCalculator(func(source, target *engine.Object) engine.Probability {
+		if isLocalAccount(source, target) && remoteUACFiltered(target, source.SID()) {
+			// Local account, still admin on interactive and RDP logons, but not over the network
+			return 10
+		}
+		return 100
+	})
 	PwnLocalRDPRights               = engine.NewPwn("RDPRights").RegisterProbabilityCalculator(func(source, target *engine.Object) engine.Probability { return 30 })
 	PwnLocalDCOMRights              = engine.NewPwn("DCOMRights").RegisterProbabilityCalculator(func(source, target *engine.Object) engine.Probability { return 50 })
 	PwnLocalSMSAdmins               = engine.NewPwn("SMSAdmins").RegisterProbabilityCalculator(func(source, target *engine.Object) engine.Probability { return 50 })
@@ -29,10 +40,9 @@ var (
 	PwnLocalSessionLastWeek         = engine.NewPwn("SessionLastWeek").RegisterProbabilityCalculator(func(source, target *engine.Object) engine.Probability { return 55 })
 	PwnLocalSessionLastMonth        = engine.NewPwn("SessionLastMonth").RegisterProbabilityCalculator(func(source, target *engine.Object) engine.Probability { return 30 })
 	PwnHasServiceAccountCredentials = engine.NewPwn("SvcAccntCreds")
-	PwnHasAutoAdminLogonCredentials = engine.NewPwn("AutoAdminLogonCreds")
+	PwnHasTaskAccountCredentials    = engine.NewPwn("TaskAccntCreds")
 	PwnRunsExecutable               = engine.NewPwn("RunsExecutable")
 	PwnHosts                        = engine.NewPwn("Hosts")
-	PwnRunsAs                       = engine.NewPwn("RunsAs")
 	PwnExecuted                     = engine.NewPwn("Executed")
 	PwnFileOwner                    = engine.NewPwn("FileOwner")
 	PwnFileTakeOwnership            = engine.NewPwn("FileTakeOwnership")
@@ -43,27 +53,38 @@ var (
 	PwnRegistryWrite                = engine.NewPwn("RegistryWrite")
 	PwnRegistryModifyDACL           = engine.NewPwn("RegistryModifyDACL")
 
-	PwnSeBackupPrivilege        = engine.NewPwn("SeBackupPrivilege")
-	PwnSeRestorePrivilege       = engine.NewPwn("SeRestorePrivilege")
+	// The other privileges are shared with the GPO user rights assignments in the activedirectory package
 	PwnSeTakeOwnershipPrivilege = engine.NewPwn("SeTakeOwnershipPrivilege")
 
-	PwnSeAssignPrimaryToken = engine.NewPwn("SeAssignPrimaryToken")
-	PwnSeCreateToken        = engine.NewPwn("SeCreateToken")
-	PwnSeDebug              = engine.NewPwn("SeDebug")
-	PwnSeImpersonate        = engine.NewPwn("SeImpersonate").RegisterProbabilityCalculator(func(source, target *engine.Object) engine.Probability { return 20 })
-	PwnSeLoadDriver         = engine.NewPwn("SeLoadDriver")
-	PwnSeManageVolume       = engine.NewPwn("SeManageVolume")
-	PwnSeTakeOwnership      = engine.NewPwn("SeTakeOwnership")
-	PwnSeTcb                = engine.NewPwn("SeTcb")
-
 	PwnSIDCollision = engine.NewPwn("SIDCollision")
 
+	// Hub objects for local accounts that share a password, so we don't need an edge between every pair of machines
+	PwnLikelySamePassword = engine.NewPwn("LikelySamePassword").Describe("Local accounts with the same name and password change time on different machines, likely deployed with the same password").RegisterProbabilityCalculator(func(source, target *engine.Object) engine.Probability {
+		if source.OneAttrString(engine.ObjectCategorySimple) == "SharedPassword" {
+			// Probability is counted on the way in
+			return 100
+		}
+		return 70
+	})
+	MetaLocalAdminNoLAPS = engine.NewAttribute("_localadminnolaps")
+
 	DNSHostname        = engine.NewAttribute("dnsHostName")
 	PwnControlsUpdates = engine.NewPwn("ControlsUpdates")
 	WUServer           = engine.NewAttribute("wuServer")
 	SCCMServer         = engine.NewAttribute("sccmServer")
 )
 
+// Task scheduler principal settings - https://docs.microsoft.com/en-us/windows/win32/api/taskschd/ne-taskschd-task_logon_type
+const (
+	TASK_LOGON_PASSWORD          = 1
+	TASK_LOGON_S4U               = 2
+	TASK_LOGON_INTERACTIVE_TOKEN = 3
+	TASK_LOGON_GROUP             = 4
+	TASK_LOGON_SERVICE_ACCOUNT   = 5
+	TASK_RUNLEVEL_LUA            = 0
+	TASK_RUNLEVEL_HIGHEST        = 1
+)
+
 func MapSID(original, new, input windowssecurity.SID) windowssecurity.SID {
 	// If input SID is one longer than machine sid
 	if input.Components() == original.Components()+1 {
@@ -77,6 +98,31 @@ func MapSID(original, new, input windowssecurity.SID) windowssecurity.SID {
 	return input
 }
 
+// remoteUACFiltered returns true if a local account on the computer only gets a filtered token over the network.
+// With UAC enabled that's every local account, except the built-in Administrator (RID 500) unless
+// FilterAdministratorToken is set. Computers without collected UAC settings are assumed unfiltered.
+// isLocalAccount returns true if the account is from the local account database of the computer
+func isLocalAccount(account, computer *engine.Object) bool {
+	sid := account.SID()
+	if sid.Component(2) != 21 {
+		return false
+	}
+	machinesid, ok := computer.OneAttrRaw(LocalMachineSID).(windowssecurity.SID)
+	return ok && sid.StripRID() == machinesid
+}
+
+func remoteUACFiltered(computer *engine.Object, sid windowssecurity.SID) bool {
+	enablelua, found := computer.AttrInt(UACEnableLUA)
+	if !found || enablelua == 0 {
+		return false
+	}
+	if latfp, _ := computer.AttrInt(UACLocalAccountTokenFilterPolicy); latfp != 0 {
+		return false
+	}
+	filteradmin, _ := computer.AttrInt(UACFilterAdministratorToken)
+	return sid.RID() != 500 || filteradmin != 0
+}
+
 func (ld *LocalMachineLoader) ImportCollectorInfo(cinfo localmachine.Info) error {
 	var computerobject *engine.Object
 	var existing bool
@@ -119,6 +165,12 @@ func (ld *LocalMachineLoader) ImportCollectorInfo(cinfo localmachine.Info) error
 		}
 	}
 
+	computerobject.SetFlex(
+		UACEnableLUA, int64(cinfo.Machine.UACEnableLUA),
+		UACLocalAccountTokenFilterPolicy, int64(cinfo.Machine.UACLocalAccountTokenFilterPolicy),
+		UACFilterAdministratorToken, int64(cinfo.Machine.UACFilterAdministratorToken),
+	)
+
 	var isdomaincontroller bool
 	if cinfo.Machine.ProductType != "" {
 		// New way of detecting domain controller
@@ -155,6 +207,11 @@ func (ld *LocalMachineLoader) ImportCollectorInfo(cinfo localmachine.Info) error
 		return fmt.Errorf("collected localmachine information for %v doesn't contain valid local machine SID (%v): %v", cinfo.Machine.Name, cinfo.Machine.LocalSID, err)
 	}
 
+	if !isdomaincontroller {
+		// Domain controllers have no local accounts, their machine SID is the domain SID
+		computerobject.SetValues(LocalMachineSID, engine.AttributeValueSID(localsid))
+	}
+
 	ld.mutex.Lock()
 	ld.machinesids[localsid] = append(ld.machinesids[localsid], computerobject)
 	ld.mutex.Unlock()
@@ -183,7 +240,8 @@ func (ld *LocalMachineLoader) ImportCollectorInfo(cinfo localmachine.Info) error
 
 	ld.ao.ReindexObject(computerobject, false) // We changed stuff after adding it
 
-	// Add local accounts as synthetic objects
+	// Add local accounts as synthetic objects, keeping them by lowercase name and SID for resolving task principals
+	localprincipals := make(map[string]*engine.Object)
 	userscontainer := engine.NewObject(activedirectory.Name, "Users")
 	ld.ao.Add(userscontainer)
 	userscontainer.ChildOf(computerobject)
@@ -225,6 +283,8 @@ func (ld *LocalMachineLoader) ImportCollectorInfo(cinfo localmachine.Info) error
 					engine.UniqueSource, uniquesource,
 				)
 				user.ChildOf(userscontainer)
+				localprincipals[strings.ToLower(user.OneAttrString(activedirectory.Name))] = user
+				localprincipals[usid.String()] = user
 			} else {
 				log.Warn().Msgf("Invalid user SID in dump: %v", user.SID)
 			}
@@ -247,10 +307,12 @@ func (ld *LocalMachineLoader) ImportCollectorInfo(cinfo localmachine.Info) error
 				engine.UniqueSource, uniquesource,
 			)
 
+			localprincipals[strings.ToLower(group.Name)] = groupobject
 			if err != nil && group.Name != "SMS Admins" {
 				log.Warn().Msgf("Can't convert local group SID %v: %v", group.SID, err)
 				continue
 			}
+			localprincipals[groupsid.String()] = groupobject
 			for _, member := range group.Members {
 				var membersid windowssecurity.SID
 				if member.SID != "" {
@@ -419,7 +481,7 @@ func (ld *LocalMachineLoader) ImportCollectorInfo(cinfo localmachine.Info) error
 			engine.DownLevelLogonName, cinfo.Machine.DefaultDomain+"\\"+cinfo.Machine.DefaultUsername,
 			activedirectory.ObjectCategorySimple, "Person",
 		)
-		computerobject.Pwns(user, PwnHasAutoAdminLogonCredentials)
+		computerobject.Pwns(user, activedirectory.PwnHasAutoAdminLogonCredentials)
 	}
 
 	// SERVICES
@@ -469,10 +531,10 @@ func (ld *LocalMachineLoader) ImportCollectorInfo(cinfo localmachine.Info) error
 				}
 
 				computerobject.Pwns(svcaccount, PwnHasServiceAccountCredentials)
-				serviceobject.Pwns(svcaccount, PwnRunsAs)
+				serviceobject.Pwns(svcaccount, activedirectory.PwnRunsAs)
 			}
 		} else if strings.EqualFold(service.Account, "LocalSystem") {
-			serviceobject.Pwns(computerobject, PwnRunsAs)
+			serviceobject.Pwns(computerobject, activedirectory.PwnRunsAs)
 		}
 
 		// Change service executable via registry
@@ -561,6 +623,150 @@ func (ld *LocalMachineLoader) ImportCollectorInfo(cinfo localmachine.Info) error
 		}
 	}
 
+	// SCHEDULED TASKS
+	if len(cinfo.Tasks) > 0 {
+		taskscontainer := engine.NewObject(activedirectory.Name, "Scheduled Tasks")
+		ld.ao.Add(taskscontainer)
+		taskscontainer.ChildOf(computerobject)
+
+		for _, task := range cinfo.Tasks {
+			if !task.Enabled {
+				continue
+			}
+
+			principal := task.Definition.Principal
+			runas := principal.UserID
+			if runas == "" {
+				runas = principal.GroupID
+			}
+			runlevel := "LeastPrivilege"
+			if principal.RunLevel == TASK_RUNLEVEL_HIGHEST {
+				runlevel = "Highest"
+			}
+
+			var commandlines []string
+			for _, action := range task.Definition.Actions {
+				if action.Path != "" {
+					commandlines = append(commandlines, strings.Trim(action.Path+" "+action.Args, " "))
+				}
+			}
+
+			taskobject := engine.NewObject(
+				engine.IgnoreBlanks,
+				activedirectory.Name, task.Name,
+				activedirectory.DisplayName, task.Name,
+				activedirectory.Description, task.Definition.RegistrationInfo.Description,
+				TaskPath, task.Path,
+				activedirectory.TaskRunAs, runas,
+				activedirectory.TaskLogonType, int64(principal.LogonType),
+				activedirectory.TaskRunLevel, runlevel,
+				activedirectory.TaskCommandLine, commandlines,
+				activedirectory.ObjectCategorySimple, "ScheduledTask",
+			)
+			ld.ao.Add(taskobject)
+			taskobject.ChildOf(taskscontainer)
+			computerobject.Pwns(taskobject, PwnHosts)
+
+			// Who does it run as, a group means any logged on member of it
+			if runas != "" {
+				identity := runas
+				runassid, err := windowssecurity.SIDFromString(identity)
+				if err == nil {
+					identity = runassid.String()
+				} else if domain, name, found := strings.Cut(identity, "\\"); found && (domain == "." || strings.EqualFold(domain, cinfo.Machine.Name) || strings.EqualFold(domain, "BUILTIN")) {
+					identity = name
+				}
+
+				var account *engine.Object
+				localprincipal, islocal := localprincipals[strings.ToLower(identity)]
+				switch {
+				case activedirectory.IsLocalSystemAccount(identity):
+					taskobject.Pwns(computerobject, activedirectory.PwnRunsAs)
+				case islocal:
+					account = localprincipal
+				case err == nil && runassid.Component(2) == 21:
+					account = ld.ao.AddNew(
+						activedirectory.ObjectSid, engine.AttributeValueSID(runassid),
+					)
+					if runassid.StripRID() == localsid {
+						account.SetFlex(
+							engine.UniqueSource, uniquesource,
+						)
+					}
+				case err != nil && strings.Contains(identity, "\\"):
+					domain, _, _ := strings.Cut(identity, "\\")
+					if strings.EqualFold(domain, "NT AUTHORITY") {
+						// Other service identities, these don't leave the machine
+						break
+					}
+					account, _ = ld.ao.FindOrAdd(
+						engine.DownLevelLogonName, engine.AttributeValueString(identity),
+					)
+				}
+				if account != nil {
+					taskobject.Pwns(account, activedirectory.PwnRunsAs)
+					if principal.UserID != "" && principal.LogonType == TASK_LOGON_PASSWORD {
+						computerobject.Pwns(account, PwnHasTaskAccountCredentials)
+					}
+				}
+			}
+
+			// Change task executable contents
+			for _, action := range task.Definition.Actions {
+				if action.Path == "" {
+					continue // COM handlers, email and message actions
+				}
+
+				taskimageobject := engine.NewObject(
+					activedirectory.DisplayName, filepath.Base(action.Path),
+					AbsolutePath, action.Path,
+					engine.ObjectCategorySimple, "Executable",
+				)
+				ld.ao.Add(taskimageobject)
+				taskimageobject.Pwns(taskobject, PwnExecuted)
+				taskimageobject.ChildOf(taskobject)
+
+				if ownersid, err := windowssecurity.SIDFromString(action.PathOwner); err == nil && ownersid.Component(2) != 80 /* Service user */ {
+					owner := ld.ao.AddNew(
+						activedirectory.ObjectSid, engine.AttributeValueSID(ownersid),
+					)
+					if ownersid.StripRID() == localsid || ownersid.Component(2) != 21 {
+						owner.SetFlex(
+							engine.UniqueSource, uniquesource,
+						)
+					}
+					owner.Pwns(taskimageobject, PwnFileOwner)
+				}
+
+				if sd, err := engine.ParseACL(action.PathDACL); err == nil {
+					for _, entry := range sd.Entries {
+						entrysid := entry.SID
+						if entry.Type == engine.ACETYPE_ACCESS_ALLOWED && (entrysid.Component(2) == 21 || entry.SID == windowssecurity.EveryoneSID || entry.SID == windowssecurity.AuthenticatedUsersSID) {
+							o := ld.ao.AddNew(
+								activedirectory.ObjectSid, engine.AttributeValueSID(entrysid),
+							)
+							if entrysid.StripRID() == localsid || entrysid.Component(2) != 21 {
+								o.SetFlex(
+									engine.UniqueSource, uniquesource,
+								)
+							}
+
+							if entry.Mask&engine.FILE_WRITE_DATA != 0 {
+								o.Pwns(taskimageobject, PwnFileWrite)
+							}
+							if entry.Mask&engine.RIGHT_WRITE_OWNER != 0 {
+								o.Pwns(taskimageobject, PwnFileTakeOwnership)
+							}
+							if entry.Mask&engine.RIGHT_WRITE_DACL != 0 {
+								o.Pwns(taskimageobject, PwnFileModifyDACL)
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+
 	// SOFTWARE INVENTORY AS ATTRIBUTES
 	installedsoftware := make([]string, len(cinfo.Software))
 	for i, software := range cinfo.Software {
@@ -577,25 +783,25 @@ func (ld *LocalMachineLoader) ImportCollectorInfo(cinfo localmachine.Info) error
 		var pwn engine.PwnMethod
 		switch pi.Name {
 		case "SeBackupPrivilege":
-			pwn = PwnSeBackupPrivilege
+			pwn = activedirectory.PwnSeBackupPrivilege
 		case "SeRestorePrivilege":
-			pwn = PwnSeRestorePrivilege
+			pwn = activedirectory.PwnSeRestorePrivilege
 		case "SeAssignPrimaryTokenPrivilege":
-			pwn = PwnSeAssignPrimaryToken
+			pwn = activedirectory.PwnSeAssignPrimaryToken
 		case "SeCreateTokenPrivilege":
-			pwn = PwnSeCreateToken
+			pwn = activedirectory.PwnSeCreateToken
 		case "SeDebugPrivilege":
-			pwn = PwnSeDebug
+			pwn = activedirectory.PwnSeDebug
 		case "SeImpersonatePrivilege":
-			pwn = PwnSeImpersonate
+			pwn = activedirectory.PwnSeImpersonate
 		case "SeLoadDriverPrivilege":
-			pwn = PwnSeLoadDriver
+			pwn = activedirectory.PwnSeLoadDriver
 		case "SeManageVolumePrivilege":
-			pwn = PwnSeManageVolume
+			pwn = activedirectory.PwnSeManageVolume
 		case "SeTakeOwnershipPrivilege":
-			pwn = PwnSeTakeOwnership
+			pwn = activedirectory.PwnSeTakeOwnership
 		case "SeTcbPrivilege":
-			pwn = PwnSeTcb
+			pwn = activedirectory.PwnSeTcb
 		default:
 			continue
 		}
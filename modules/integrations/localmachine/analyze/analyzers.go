@@ -1,7 +1,13 @@
 package analyze
 
 import (
+	"fmt"
+	"strings"
+	"time"
+
 	"github.com/lkarlslund/adalanche/modules/engine"
+	"github.com/lkarlslund/adalanche/modules/integrations/activedirectory"
+	"github.com/lkarlslund/adalanche/modules/windowssecurity"
 	"github.com/rs/zerolog/log"
 )
 
@@ -40,4 +46,93 @@ func init() {
 		engine.AfterMerge,
 	)
 
+	loader.AddProcessor(
+		correlateLocalAccounts,
+		"Correlate local accounts likely sharing passwords across machines",
+		engine.AfterMerge,
+	)
+
+}
+
+// correlateLocalAccounts flags enabled RID 500 accounts on computers without LAPS, and links local accounts with the
+// same name and password change time on different machines
+func correlateLocalAccounts(ao *engine.Objects) {
+	// The same index as the loaders machinesids, rebuilt here as merging can replace the computer objects
+	machinesids := make(map[windowssecurity.SID][]*engine.Object)
+	for _, computer := range ao.Filter(func(o *engine.Object) bool {
+		return o.Type() == engine.ObjectTypeComputer && o.HasAttr(LocalMachineSID)
+	}).Slice() {
+		if machinesid, ok := computer.OneAttrRaw(LocalMachineSID).(windowssecurity.SID); ok {
+			machinesids[machinesid] = append(machinesids[machinesid], computer)
+		}
+	}
+
+	type passwordkey struct {
+		name       string
+		lastchange int64
+	}
+	accounts := make(map[passwordkey][]*engine.Object)
+
+	for _, o := range ao.Slice() {
+		if o.Type() != engine.ObjectTypeUser || o.SID().Component(2) != 21 {
+			continue
+		}
+		computer := localAccountComputer(o, machinesids)
+		if computer == nil {
+			continue
+		}
+
+		if o.SID().RID() == 500 {
+			uac, _ := o.AttrInt(activedirectory.UserAccountControl)
+			if uac&engine.UAC_ACCOUNTDISABLE == 0 && !computer.HasAttr(activedirectory.MSmcsAdmPwdExpirationTime) && !computer.HasAttr(activedirectory.MSLAPSPwdExpirationTime) {
+				computer.SetValues(MetaLocalAdminNoLAPS, engine.AttributeValueInt(1))
+			}
+		}
+
+		lastchange, ok := o.OneAttrRaw(activedirectory.PwdLastSet).(time.Time)
+		if !ok || lastchange.IsZero() {
+			continue
+		}
+		key := passwordkey{
+			name:       strings.ToLower(o.OneAttrString(activedirectory.Name)),
+			lastchange: lastchange.Unix(),
+		}
+		accounts[key] = append(accounts[key], o)
+	}
+
+	var groups int
+	for key, group := range accounts {
+		if len(group) < 2 {
+			continue
+		}
+		shared := engine.NewObject(
+			activedirectory.Name, fmt.Sprintf("Likely shared password for %v set %v", key.name, time.Unix(key.lastchange, 0).UTC().Format(time.RFC3339)),
+			engine.ObjectCategorySimple, "SharedPassword",
+		)
+		ao.Add(shared)
+		for _, account := range group {
+			account.Pwns(shared, PwnLikelySamePassword)
+			shared.Pwns(account, PwnLikelySamePassword)
+		}
+		groups++
+	}
+	if groups > 0 {
+		log.Info().Msgf("Found %v groups of local accounts that likely share passwords across machines", groups)
+	}
+}
+
+// localAccountComputer returns the computer whose local account database the account is from, or nil for domain
+// accounts. Cloned machines share the local SID, so then the account is matched on the machine name it was imported from
+func localAccountComputer(account *engine.Object, machinesids map[windowssecurity.SID][]*engine.Object) *engine.Object {
+	computers := machinesids[account.SID().StripRID()]
+	if len(computers) == 1 {
+		return computers[0]
+	}
+	source := account.OneAttrString(engine.UniqueSource)
+	for _, computer := range computers {
+		if source != "" && strings.EqualFold(computer.OneAttrString(activedirectory.Name), source) {
+			return computer
+		}
+	}
+	return nil
 }
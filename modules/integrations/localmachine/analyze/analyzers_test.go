@@ -0,0 +1,84 @@
+package analyze
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lkarlslund/adalanche/modules/engine"
+	"github.com/lkarlslund/adalanche/modules/integrations/activedirectory"
+	"github.com/lkarlslund/adalanche/modules/windowssecurity"
+)
+
+func TestCorrelateLocalAccounts(t *testing.T) {
+	ao := engine.NewObjects()
+
+	computer := func(name, machinesid string) *engine.Object {
+		sid, err := windowssecurity.SIDFromString(machinesid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		o := engine.NewObject(
+			activedirectory.Name, name,
+			engine.ObjectCategorySimple, "Computer",
+			LocalMachineSID, engine.AttributeValueSID(sid),
+		)
+		ao.Add(o)
+		return o
+	}
+	account := func(machine, name, usersid string, pwdlastset time.Time) *engine.Object {
+		sid, err := windowssecurity.SIDFromString(usersid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		o := engine.NewObject(
+			activedirectory.ObjectSid, engine.AttributeValueSID(sid),
+			activedirectory.Name, name,
+			engine.ObjectCategorySimple, "Person",
+			activedirectory.UserAccountControl, int64(512),
+			activedirectory.PwdLastSet, pwdlastset,
+			engine.UniqueSource, machine,
+		)
+		ao.Add(o)
+		return o
+	}
+
+	deployed := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+
+	ws1 := computer("WS1", "S-1-5-21-1-2-3")
+	ws2 := computer("WS2", "S-1-5-21-4-5-6")
+	ws1admin := account("WS1", "Administrator", "S-1-5-21-1-2-3-500", deployed)
+	ws2admin := account("WS2", "administrator", "S-1-5-21-4-5-6-500", deployed)
+	// Same name, but the password was changed later
+	ws2support := account("WS2", "support", "S-1-5-21-4-5-6-1001", deployed.Add(time.Hour))
+	ws1support := account("WS1", "support", "S-1-5-21-1-2-3-1001", deployed)
+	// Domain account with the same name and password change time isn't a local account
+	domainadmin := account("corp.local", "Administrator", "S-1-5-21-7-8-9-500", deployed)
+
+	correlateLocalAccounts(ao)
+
+	var shared []*engine.Object
+	for _, o := range ao.Slice() {
+		if o.OneAttrString(engine.ObjectCategorySimple) == "SharedPassword" {
+			shared = append(shared, o)
+		}
+	}
+	if len(shared) != 1 {
+		t.Fatalf("got %v shared password objects, want 1", len(shared))
+	}
+
+	linked := func(o *engine.Object) bool {
+		return o.CanPwn[shared[0]].IsSet(PwnLikelySamePassword) && shared[0].CanPwn[o].IsSet(PwnLikelySamePassword)
+	}
+	if !linked(ws1admin) || !linked(ws2admin) {
+		t.Error("local administrators with the same password change time are not linked")
+	}
+	if linked(ws1support) || linked(ws2support) || linked(domainadmin) {
+		t.Error("accounts with different password change times or from the domain are linked")
+	}
+
+	for _, c := range []*engine.Object{ws1, ws2} {
+		if v, _ := c.AttrInt(MetaLocalAdminNoLAPS); v != 1 {
+			t.Errorf("%v without LAPS is not flagged", c.Label())
+		}
+	}
+}